@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/host"
+	"github.com/WillyV3/distributed/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var refreshFlag bool
+
+func factsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "facts [host...]",
+		Short: "Show platform and toolchain facts of hosts",
+		Long: "Show each host's OS, kernel, architecture, CPU, memory, free disk and installed " +
+			"toolchains. Facts are cached in ~/.cache/distributed and collected again once they " +
+			"are older than the facts ttl in config.yaml (default 24h). They are available to " +
+			"--selector and to label scoring as os, arch, kernel, ram and one label per tool.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hosts := args
+			if len(hosts) == 0 {
+				var err error
+				if hosts, err = getTargetHosts(); err != nil {
+					return err
+				}
+			}
+
+			opts, err := probeOptions()
+			if err != nil {
+				return err
+			}
+			opts.Facts.Refresh = refreshFlag
+
+			ui.Info(fmt.Sprintf("Collecting facts from %d hosts", len(hosts)))
+			var rows []hostFacts
+			for _, info := range host.ProbeAll(cmd.Context(), tr, hosts, opts, nil) {
+				if info.Reachable && !opts.Selector.Matches(info.Labels) {
+					continue
+				}
+				row := hostFacts{Host: info.Host, Reachable: info.Reachable, Facts: info.Facts, Labels: info.Labels}
+				if row.Facts == nil {
+					// Offline hosts still show what was last known
+					row.Facts, _ = opts.Facts.Lookup(info.Host)
+				}
+				rows = append(rows, row)
+			}
+
+			if structured() {
+				return emit(factsDoc{Hosts: rows})
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "HOST\tOS\tARCH\tKERNEL\tCPUS\tRAM\tDISK FREE\tCPU MODEL\tTOOLS\tAGE")
+			for _, row := range rows {
+				f := row.Facts
+				if f == nil {
+					fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t-\t-\t-\toffline\n", row.Host)
+					continue
+				}
+
+				age := ago(f.Age())
+				if !row.Reachable {
+					age += " (offline)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+					row.Host, f.OS, f.Arch, f.Kernel, f.CPUs, sizeMB(f.MemTotalMB), sizeMB(f.DiskFreeMB),
+					f.CPUModel, toolList(f.Tools), age)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only show hosts whose labels match, e.g. `go,ram=64G`")
+	cmd.Flags().BoolVar(&refreshFlag, "refresh", false, "Collect facts again even if the cached ones are fresh")
+	return cmd
+}
+
+// toolList formats tool versions as "go 1.22.1, rsync 3.2.7"
+func toolList(tools map[string]string) string {
+	if len(tools) == 0 {
+		return "-"
+	}
+	var parts []string
+	for _, tool := range host.Tools {
+		if version, ok := tools[tool]; ok {
+			parts = append(parts, tool+" "+version)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sizeMB formats a size in megabytes, e.g. "512M" or "62.8G"
+func sizeMB(mb int) string {
+	if mb < 1024 {
+		return fmt.Sprintf("%dM", mb)
+	}
+	return fmt.Sprintf("%.1fG", float64(mb)/1024)
+}
+
+// ago formats an age coarsely, e.g. "5m ago" or "3d ago"
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
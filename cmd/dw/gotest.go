@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/WillyV3/distributed/internal/gotest"
+	"github.com/WillyV3/distributed/internal/host"
+	"github.com/WillyV3/distributed/internal/remote"
+	"github.com/WillyV3/distributed/internal/run"
+	"github.com/WillyV3/distributed/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var jsonFlag bool
+
+func testCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test [packages...] [-- go test flags...]",
+		Short: "Run go test split across hosts",
+		Long: "List packages locally, split them across the reachable hosts in the group by CPU count " +
+			"and load, sync the current directory and test each share remotely. Results are merged " +
+			"into one report. Arguments after -- are passed to go test.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			patterns, flags := args, []string(nil)
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+				patterns, flags = args[:dash], args[dash:]
+			}
+			if len(patterns) == 0 {
+				patterns = []string{"./..."}
+			}
+
+			if jsonFlag {
+				if structured() {
+					return errors.New("--json cannot be combined with --output")
+				}
+				// Keep stdout clean for the event stream
+				ui.SetOutput(os.Stderr)
+			}
+
+			ctx, cancel := withTimeout(cmd.Context())
+			defer cancel()
+
+			packages, err := gotest.List(ctx, ".", patterns)
+			if err != nil {
+				return err
+			}
+			if len(packages) == 0 {
+				return errors.New("no packages to test")
+			}
+
+			hosts, err := getTargetHosts()
+			if err != nil {
+				return err
+			}
+
+			opts, err := probeOptions()
+			if err != nil {
+				return err
+			}
+
+			ui.Info(fmt.Sprintf("Probing %d hosts", len(hosts)))
+			var candidates []*host.LoadInfo
+			for _, info := range host.ProbeAll(ctx, tr, hosts, opts, nil) {
+				if opts.Accepts(info) {
+					candidates = append(candidates, info)
+				}
+			}
+			if len(candidates) == 0 {
+				return noHostsError()
+			}
+
+			shards := gotest.Partition(packages, candidates)
+			shardHosts := make([]string, len(shards))
+			for i, shard := range shards {
+				shardHosts[i] = shard.Host
+				ui.Info(fmt.Sprintf("%s: %d packages", shard.Host, len(shard.Packages)))
+			}
+
+			layout, err := syncLayout()
+			if err != nil {
+				return err
+			}
+			_, dir, err := layout.MirrorPath(".")
+			if err != nil {
+				return err
+			}
+			if err := layout.Push(ctx, tr, ".", shardHosts, false); err != nil {
+				if stopErr := stopError(ctx); stopErr != nil {
+					return stopErr
+				}
+				return err
+			}
+
+			jobs := make([]run.Job, len(shards))
+			for i, shard := range shards {
+				command, err := remoteCommand(shard.Command(flags))
+				if err != nil {
+					return err
+				}
+				jobs[i] = run.Job{Host: shard.Host, Command: remote.InDir(dir, command)}
+			}
+
+			ui.Info(fmt.Sprintf("Testing %d packages on %d hosts", len(packages), len(shards)))
+			results := run.OnEach(ctx, tr, jobs, run.Options{Capture: true})
+
+			report := gotest.NewReport(shards)
+			for _, r := range results {
+				report.Add(r.Host, []byte(r.Stdout))
+				report.AddOutput(r.Host, r.Stderr)
+			}
+
+			switch {
+			case jsonFlag:
+				err = report.WriteJSON(os.Stdout)
+			case structured():
+				err = emit(testDoc{Shards: shards, Packages: report.Packages, Passed: report.Passed()})
+			default:
+				err = printTestReport(report, results)
+			}
+			if err != nil {
+				return err
+			}
+
+			if stopErr := stopError(ctx); stopErr != nil {
+				return stopErr
+			}
+			return testError(cmd, report, results)
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonFlag, "json", false, "Write the combined go test -json stream to stdout")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only use hosts whose labels match, e.g. `os=linux,arch=amd64`")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Stop the tests on every host after this long (0 means no limit)")
+	return cmd
+}
+
+// testError returns the exitError for a test run. Hosts that failed
+// before reporting every package exit like dw run --all does: 2 if some
+// of them failed and 3 if all did. Otherwise failed packages exit 1, as
+// go test does.
+func testError(cmd *cobra.Command, report *gotest.Report, results []run.Result) error {
+	var lost []string
+	for _, r := range results {
+		if !hostReported(report, r.Host) {
+			lost = append(lost, r.Host)
+		}
+	}
+	failed := report.Failed()
+
+	var code int
+	var msg string
+	switch {
+	case len(lost) == len(results):
+		code, msg = run.ExitAllFailed, fmt.Sprintf("all %d hosts failed to run the tests", len(results))
+	case len(lost) > 0:
+		code, msg = run.ExitSomeFailed, fmt.Sprintf("%d of %d hosts failed to run the tests: %s",
+			len(lost), len(results), strings.Join(lost, ", "))
+	case len(failed) > 0:
+		code, msg = 1, fmt.Sprintf("%d of %d packages failed", len(failed), len(report.Packages))
+	default:
+		return nil
+	}
+
+	cmd.SilenceUsage = true
+	return &exitError{code: code, msg: msg}
+}
+
+// hostReported reports whether every package shared out to h has a result
+func hostReported(report *gotest.Report, h string) bool {
+	for _, p := range report.Packages {
+		if p.Host == h && p.Status == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// printTestReport prints the output of failed packages followed by one
+// line per package, in the style of go test
+func printTestReport(report *gotest.Report, results []run.Result) error {
+	for _, p := range report.Failed() {
+		if p.Output != "" {
+			fmt.Print(p.Output)
+		}
+	}
+
+	// A host whose packages never reported probably failed to run go
+	// test at all, so show what it printed instead
+	for _, r := range results {
+		if hostReported(report, r.Host) {
+			continue
+		}
+		if out := report.HostOutput(r.Host); out != "" {
+			fmt.Printf("# %s\n%s", r.Host, out)
+		}
+		if r.Err != nil {
+			ui.Error(fmt.Sprintf("%s: %v", r.Host, r.Err))
+		}
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, p := range report.Packages {
+		status, detail := "ok", fmt.Sprintf("%.3fs", p.Elapsed)
+		switch p.Status {
+		case gotest.StatusFail:
+			status = "FAIL"
+			if len(p.FailedTests) > 0 {
+				detail += " " + strings.Join(p.FailedTests, ", ")
+			}
+		case gotest.StatusSkip:
+			status, detail = "?", "[no test files]"
+		case "":
+			status, detail = "FAIL", "[no result]"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status, p.Package, p.Host, detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		ui.Error(fmt.Sprintf("%d of %d packages failed", len(failed), len(report.Packages)))
+	} else {
+		ui.Success(fmt.Sprintf("%d packages passed on %d hosts", len(report.Packages), len(results)))
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/inventory"
+	"github.com/WillyV3/distributed/internal/tailscale"
+	"github.com/WillyV3/distributed/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var forceFlag bool
+
+func groupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "group",
+		Short: "Manage host groups in config.yaml",
+		Long: "List and edit the groups in config.yaml. Comments and ordering in the file are kept. " +
+			"Groups defined by inventory files or scripts are listed by dw inventory and edited at " +
+			"their source.",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List groups and their hosts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			if structured() {
+				doc := groupsDoc{Groups: []groupDoc{}}
+				for _, name := range slices.Sorted(maps.Keys(cfg.Groups)) {
+					doc.Groups = append(doc.Groups, groupDoc{Name: name, Hosts: cfg.Groups[name]})
+				}
+				return emit(doc)
+			}
+
+			if len(cfg.Groups) == 0 {
+				ui.Info("No groups")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "GROUP\tHOSTS")
+			for _, name := range slices.Sorted(maps.Keys(cfg.Groups)) {
+				fmt.Fprintf(w, "%s\t%s\n", name, dash(strings.Join(cfg.Groups[name], ", ")))
+			}
+			return w.Flush()
+		},
+	})
+
+	create := &cobra.Command{
+		Use:   "create <group> [host...]",
+		Short: "Create a group, optionally with hosts",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editGroups(func(cfg *config.Config) (groupDoc, string, error) {
+				if err := checkHosts(args[1:]); err != nil {
+					return groupDoc{}, "", err
+				}
+				if err := cfg.CreateGroup(args[0]); err != nil {
+					return groupDoc{}, "", err
+				}
+				for _, h := range args[1:] {
+					cfg.AddToGroup(args[0], h)
+				}
+				return newGroupDoc(cfg, args[0]), fmt.Sprintf("Created group %s", args[0]), nil
+			})
+		},
+	}
+	create.Flags().BoolVar(&forceFlag, "force", false, "Add hosts even if no inventory lists them")
+	cmd.AddCommand(create)
+
+	del := &cobra.Command{
+		Use:   "delete <group>",
+		Short: "Delete a group",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editGroups(func(cfg *config.Config) (groupDoc, string, error) {
+				users := cfg.Referrers(args[0])
+				if config.ExpressionUses(cfg.Group, args[0]) {
+					users = append(users, "the default group")
+				}
+				project := projectGroupUsing(args[0])
+				if !forceFlag && (len(users) > 0 || project != "") {
+					if project != "" {
+						users = append(users, "the group in "+project)
+					}
+					return groupDoc{}, "", fmt.Errorf("group %q is used by %s (use --force to delete it and drop those references)",
+						args[0], strings.Join(users, ", "))
+				}
+				if len(users) > 0 {
+					cfg.DropReferences(args[0])
+					ui.Info(fmt.Sprintf("Removed %s from %s", args[0], strings.Join(users, ", ")))
+				}
+				if project != "" {
+					ui.Info(fmt.Sprintf("The group in %s still names %s; remove it there too", project, args[0]))
+				}
+				hosts, err := cfg.DeleteGroup(args[0])
+				if err != nil {
+					return groupDoc{}, "", err
+				}
+				return groupDoc{Name: args[0], Hosts: hosts}, fmt.Sprintf("Deleted group %s", args[0]), nil
+			})
+		},
+	}
+	del.Flags().BoolVar(&forceFlag, "force", false, "Also remove the group from the groups and default group referring to it")
+	cmd.AddCommand(del)
+
+	add := &cobra.Command{
+		Use:   "add <group> <host...>",
+		Short: "Add hosts to a group",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editGroups(func(cfg *config.Config) (groupDoc, string, error) {
+				if _, ok := cfg.Groups[args[0]]; !ok {
+					return groupDoc{}, "", fmt.Errorf("group %q not found; create it with dw group create", args[0])
+				}
+				if err := checkHosts(args[1:]); err != nil {
+					return groupDoc{}, "", err
+				}
+
+				var added []string
+				for _, h := range args[1:] {
+					if cfg.AddToGroup(args[0], h) {
+						added = append(added, h)
+					} else {
+						ui.Info(fmt.Sprintf("%s is already in %s", h, args[0]))
+					}
+				}
+				msg := ""
+				if len(added) > 0 {
+					msg = fmt.Sprintf("Added %s to %s", strings.Join(added, ", "), args[0])
+				}
+				return newGroupDoc(cfg, args[0]), msg, nil
+			})
+		},
+	}
+	add.Flags().BoolVar(&forceFlag, "force", false, "Add hosts even if no inventory lists them")
+	cmd.AddCommand(add)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove <group> <host...>",
+		Short: "Remove hosts from a group",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editGroups(func(cfg *config.Config) (groupDoc, string, error) {
+				for _, h := range args[1:] {
+					if err := cfg.RemoveFromGroup(args[0], h); err != nil {
+						return groupDoc{}, "", err
+					}
+				}
+				return newGroupDoc(cfg, args[0]), fmt.Sprintf("Removed %s from %s", strings.Join(args[1:], ", "), args[0]), nil
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rename <group> <new-name>",
+		Short: "Rename a group and the references to it",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editGroups(func(cfg *config.Config) (groupDoc, string, error) {
+				if err := cfg.RenameGroup(args[0], args[1]); err != nil {
+					return groupDoc{}, "", err
+				}
+				if project := projectGroupUsing(args[0]); project != "" {
+					ui.Info(fmt.Sprintf("The group in %s still names %s; rename it there too", project, args[0]))
+				}
+				return newGroupDoc(cfg, args[1]), fmt.Sprintf("Renamed group %s to %s", args[0], args[1]), nil
+			})
+		},
+	})
+
+	return cmd
+}
+
+// editGroups loads the config, applies edit and saves the result. edit
+// returns the group as it ends up, emitted with --output, and a message
+// shown otherwise.
+func editGroups(edit func(cfg *config.Config) (groupDoc, string, error)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	doc, msg, err := edit(cfg)
+	if err != nil {
+		return err
+	}
+	if err := checkGroups(cfg); err != nil {
+		return err
+	}
+	if err := config.Save(cfg); err != nil {
+		return err
+	}
+
+	if structured() {
+		return emit(doc)
+	}
+	if msg != "" {
+		ui.Success(msg)
+	}
+	return nil
+}
+
+// projectGroupUsing returns the .dw.yaml whose group names the group
+// name, or "". dw group only edits config.yaml, so that file is left to
+// the user.
+func projectGroupUsing(name string) string {
+	e, err := loadConfig()
+	if err != nil || e.ProjectPath == "" {
+		return ""
+	}
+	for _, s := range e.Settings {
+		if s.Key == "group" && s.Source == e.ProjectPath && config.ExpressionUses(s.Value, name) {
+			return e.ProjectPath
+		}
+	}
+	return ""
+}
+
+// checkGroups resolves every group as it would be after saving cfg, so
+// cycles such as a group including itself and @references to missing
+// groups are caught before they are written
+func checkGroups(cfg *config.Config) error {
+	view, err := inventory.Load(context.Background(), inventory.Sources(cfg))
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Groups)) {
+		if _, err := view.Group(name); err != nil {
+			return fmt.Errorf("group %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkHosts makes sure every host is listed by some inventory and every
+// @group exists, so typos don't end up in a group. Globs and tailscale:
+// entries are resolved when used.
+func checkHosts(hosts []string) error {
+	if forceFlag {
+		return nil
+	}
+
+	view, err := loadInventory()
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		h = strings.TrimPrefix(h, "!")
+		switch {
+		case strings.HasPrefix(h, tailscale.GroupPrefix):
+			if _, err := tailscale.ParseFilter(h); err != nil {
+				return err
+			}
+		case strings.HasPrefix(h, "@"):
+			if _, ok := view.Groups[h[1:]]; !ok {
+				return fmt.Errorf("group %q not found", h[1:])
+			}
+		case strings.ContainsAny(h, "*?["):
+			if _, err := path.Match(h, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", h, err)
+			}
+		default:
+			if _, ok := view.Host(h); !ok {
+				return fmt.Errorf("host %q is not in any inventory (use --force to add it anyway)", h)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/inventory"
+	"github.com/WillyV3/distributed/internal/transport"
+	"github.com/spf13/cobra"
+)
+
+func inventoryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inventory",
+		Short: "List hosts and groups from every inventory source",
+		Long: "List the hosts and groups dw knows about, merged from ~/.ssh/config, the inventory " +
+			"files and scripts in config.yaml, and the hosts and groups in config.yaml itself. " +
+			"Later sources override the address, user, port and labels of earlier ones.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			view, err := loadInventory()
+			if err != nil {
+				return err
+			}
+
+			if structured() {
+				return emit(inventoryDoc{Hosts: view.Hosts, Groups: view.Groups})
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "HOST\tADDRESS\tUSER\tPORT\tLABELS\tSOURCES")
+			for _, h := range view.Hosts {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", h.Name, dash(h.Address), dash(h.User), dash(h.Port),
+					dash(labelList(h.Labels)), strings.Join(h.Sources, ", "))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			if len(view.Groups) == 0 {
+				return nil
+			}
+			fmt.Println()
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "GROUP\tHOSTS")
+			for _, name := range slices.Sorted(maps.Keys(view.Groups)) {
+				fmt.Fprintf(w, "%s\t%s\n", name, dash(strings.Join(view.Groups[name], ", ")))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+var (
+	inventoryOnce sync.Once
+	inventoryView *inventory.View
+	inventoryErr  error
+)
+
+// loadInventory merges every inventory source in the config. Scripts can
+// be slow, so this happens at most once per invocation.
+func loadInventory() (*inventory.View, error) {
+	inventoryOnce.Do(func() {
+		var cfg *config.Config
+		if cfg, inventoryErr = config.Load(); inventoryErr != nil {
+			return
+		}
+		inventoryView, inventoryErr = inventory.Load(context.Background(), inventory.Sources(cfg))
+	})
+	return inventoryView, inventoryErr
+}
+
+// resolveEndpoint tells the transport how to reach hosts whose address,
+// user or port come from an inventory rather than ~/.ssh/config
+func resolveEndpoint(name string) (transport.Endpoint, bool) {
+	view, err := loadInventory()
+	if err != nil {
+		// Commands that need the inventory report the error themselves
+		return transport.Endpoint{}, false
+	}
+	h, ok := view.Host(name)
+	if !ok || !h.Overridden() {
+		return transport.Endpoint{}, false
+	}
+	return transport.Endpoint{Address: h.Address, User: h.User, Port: h.Port}, true
+}
+
+// labelList formats labels as "k=v,k=v", sorted by name
+func labelList(labels map[string]string) string {
+	var parts []string
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		parts = append(parts, name+"="+labels[name])
+	}
+	return strings.Join(parts, ",")
+}
+
+// dash stands in for an empty table cell
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
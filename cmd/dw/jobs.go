@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/host"
+	"github.com/WillyV3/distributed/internal/jobs"
+	"github.com/WillyV3/distributed/internal/remote"
+	"github.com/WillyV3/distributed/internal/run"
+	"github.com/WillyV3/distributed/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	followFlag bool
+	pruneFlag  bool
+	signalFlag string
+)
+
+func submitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "submit [command...]",
+		Short: "Start a command in the background on the best host",
+		Long: "Start command detached on the best host and return at once. " +
+			"Use dw jobs, dw logs and dw kill to follow it later.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			command := strings.Join(args, " ")
+			ctx := cmd.Context()
+
+			hosts, err := getTargetHosts()
+			if err != nil {
+				return err
+			}
+
+			opts, err := probeOptions()
+			if err != nil {
+				return err
+			}
+
+			var best *host.LoadInfo
+			err = ui.Spin("Finding best host", func() error {
+				var findErr error
+				best, findErr = host.FindBest(ctx, tr, hosts, opts)
+				return findErr
+			})
+			if err != nil {
+				return err
+			}
+
+			remoteCmd, err := remoteCommand(command)
+			if err != nil {
+				return err
+			}
+			remoteCmd, dir, err := syncForRun(ctx, []string{best.Host}, remoteCmd)
+			if err != nil {
+				return err
+			}
+
+			job := jobs.New(best.Host, command, dir)
+			out, err := tr.Output(ctx, best.Host, remote.Detach(job.ID, remoteCmd))
+			if err != nil {
+				return fmt.Errorf("failed to start job on %s: %w", best.Host, err)
+			}
+			job.PID, err = strconv.Atoi(strings.TrimSpace(string(out)))
+			if err != nil {
+				return fmt.Errorf("failed to start job on %s: unexpected output %q", best.Host, out)
+			}
+
+			if err := jobs.Add(job); err != nil {
+				return fmt.Errorf("job %s started on %s but could not be recorded: %w", job.ID, job.Host, err)
+			}
+
+			if structured() {
+				return emit(job)
+			}
+
+			ui.Success(fmt.Sprintf("Submitted job %s on %s (pid %d)", job.ShortID(), job.Host, job.PID))
+			ui.Info(fmt.Sprintf("Follow it with: dw logs -f %s", job.ShortID()))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only use hosts whose labels match, e.g. `os=linux,arch=amd64`")
+	cmd.Flags().StringVar(&syncFlag, "sync", "", "Sync `path` to the chosen host first and run from its remote mirror")
+	cmd.Flags().StringArrayVar(&envFlag, "env", nil, "Set `KEY=VALUE` in the command's environment (repeatable)")
+	cmd.Flags().Lookup("sync").NoOptDefVal = "."
+	return cmd
+}
+
+func jobsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "List submitted jobs and their status",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := jobs.Load()
+			if err != nil {
+				return err
+			}
+
+			statuses := jobStatuses(cmd.Context(), list)
+
+			if pruneFlag {
+				// Keep jobs still running and those whose host didn't answer,
+				// as well as any submitted while the hosts were asked
+				finished := func(j jobs.Job) bool {
+					status, ok := statuses[j.ID]
+					return ok && !status.Running
+				}
+				kept := slices.DeleteFunc(slices.Clone(list), finished)
+				if err := jobs.Update(func(current []jobs.Job) []jobs.Job {
+					return slices.DeleteFunc(current, finished)
+				}); err != nil {
+					return err
+				}
+				ui.Info(fmt.Sprintf("Pruned %d finished jobs", len(list)-len(kept)))
+				list = kept
+			}
+
+			if structured() {
+				doc := jobsDoc{Jobs: []jobState{}}
+				for _, j := range list {
+					doc.Jobs = append(doc.Jobs, newJobState(j, statuses))
+				}
+				return emit(doc)
+			}
+
+			if len(list) == 0 {
+				ui.Info("No jobs")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tHOST\tSTATUS\tPID\tSUBMITTED\tCOMMAND")
+			for _, j := range list {
+				status := "? unreachable"
+				if s, ok := statuses[j.ID]; ok {
+					status = s.String()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+					j.ShortID(), j.Host, status, j.PID, j.Submitted.Local().Format(time.DateTime), j.Command)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&pruneFlag, "prune", false, "Forget jobs that have finished")
+	return cmd
+}
+
+func logsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs <id>",
+		Short: "Print the output of a submitted job",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			job, err := findJob(args[0])
+			if err != nil {
+				return err
+			}
+
+			err = tr.Run(cmd.Context(), job.Host, remote.Logs(job.ID, followFlag), nil, os.Stdout, os.Stderr)
+			if cmd.Context().Err() != nil {
+				// Ctrl-C only stops following; the job keeps running
+				return nil
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVarP(&followFlag, "follow", "f", false, "Keep printing output until the job exits")
+	return cmd
+}
+
+// signalName matches signal names Stop can pass to kill -s
+var signalName = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+func killCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kill <id>",
+		Short: "Stop a submitted job",
+		Long: fmt.Sprintf("Send --signal to every process of a submitted job and kill whatever is "+
+			"still running %s later.", run.GracePeriod),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			job, err := findJob(args[0])
+			if err != nil {
+				return err
+			}
+
+			sig := strings.TrimPrefix(strings.ToUpper(signalFlag), "SIG")
+			if !signalName.MatchString(sig) {
+				return fmt.Errorf("invalid signal %q", signalFlag)
+			}
+
+			err = ui.Spin(fmt.Sprintf("Stopping job %s on %s", job.ShortID(), job.Host), func() error {
+				_, err := tr.Output(cmd.Context(), job.Host, remote.Stop(job.ID, sig, run.GracePeriod))
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to stop job on %s: %w", job.Host, err)
+			}
+
+			ui.Success(fmt.Sprintf("Stopped job %s", job.ShortID()))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&signalFlag, "signal", "s", "TERM", "Signal to send first")
+	return cmd
+}
+
+// findJob looks up a submitted job by id or id prefix
+func findJob(prefix string) (jobs.Job, error) {
+	list, err := jobs.Load()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	return jobs.Find(list, prefix)
+}
+
+// jobStatuses asks each host about its jobs, all hosts at once. Jobs on
+// hosts that don't answer within --probe-deadline are left out.
+func jobStatuses(ctx context.Context, list []jobs.Job) map[string]remote.JobStatus {
+	byHost := make(map[string][]string)
+	for _, j := range list {
+		byHost[j.Host] = append(byHost[j.Host], j.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deadlineFlag)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	statuses := make(map[string]remote.JobStatus)
+	for h, ids := range byHost {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := tr.Output(ctx, h, remote.Status(ids...))
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for id, status := range remote.ParseStatus(string(out)) {
+				statuses[id] = status
+			}
+		}()
+	}
+	wg.Wait()
+
+	return statuses
+}
@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 	"time"
 
 	"github.com/WillyV3/distributed/internal/config"
 	"github.com/WillyV3/distributed/internal/host"
+	"github.com/WillyV3/distributed/internal/inventory"
+	"github.com/WillyV3/distributed/internal/output"
+	"github.com/WillyV3/distributed/internal/remote"
 	"github.com/WillyV3/distributed/internal/run"
 	"github.com/WillyV3/distributed/internal/sync"
+	"github.com/WillyV3/distributed/internal/transport"
 	"github.com/WillyV3/distributed/internal/ui"
 	"github.com/spf13/cobra"
 )
@@ -20,6 +31,30 @@ var (
 	hostFlag   string
 	allFlag    bool
 	dryRunFlag bool
+
+	groupOutputFlag bool
+	noColorFlag     bool
+	transportFlag   string
+	workersFlag     int
+	deadlineFlag    time.Duration
+	outputFlag      string
+	syncFlag        string
+	artifactsFlag   []string
+	pathFlag        string
+	timeoutFlag     time.Duration
+	retriesFlag     int
+	parallelFlag    int
+	batchSizeFlag   int
+	serialFlag      bool
+	failFastFlag    bool
+	selectorFlag    string
+	envFlag         []string
+
+	// outputFormat is the parsed --output flag
+	outputFormat output.Format
+
+	// tr is the transport selected by --transport
+	tr transport.Transport
 )
 
 func main() {
@@ -27,61 +62,141 @@ func main() {
 		Use:   "dw",
 		Short: "Distributed development across machines",
 		Long:  "Manage distributed development across multiple machines using SSH and rsync",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			outputFormat, err = output.ParseFormat(outputFlag)
+			if err != nil {
+				return err
+			}
+
+			// Keep stdout clean for the document
+			if structured() {
+				ui.SetOutput(os.Stderr)
+			}
+
+			tr, err = transport.New(transportFlag, resolveEndpoint)
+			return err
+		},
 	}
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVarP(&groupFlag, "group", "g", "dev", "Target group")
+	rootCmd.PersistentFlags().StringVarP(&groupFlag, "group", "g", "", "Target group (default: group from .dw.yaml or config.yaml, else "+config.DefaultGroup+")")
 	rootCmd.PersistentFlags().StringVar(&hostFlag, "host", "", "Target specific host")
 	rootCmd.PersistentFlags().BoolVar(&allFlag, "all", false, "Target all hosts in group")
+	rootCmd.PersistentFlags().IntVar(&workersFlag, "probe-workers", host.DefaultWorkers, "Maximum hosts probed at once")
+	rootCmd.PersistentFlags().DurationVar(&deadlineFlag, "probe-deadline", host.DefaultDeadline, "Total time allowed for probing hosts")
+	rootCmd.PersistentFlags().StringVar(&transportFlag, "transport", "exec", "SSH transport: exec (ssh binary) or native (pooled connections)")
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o", "table", "Output format: table, json or yaml")
 
 	// Commands
 	rootCmd.AddCommand(statusCmd())
+	rootCmd.AddCommand(inventoryCmd())
+	rootCmd.AddCommand(tailscaleCmd())
 	rootCmd.AddCommand(loadCmd())
+	rootCmd.AddCommand(factsCmd())
 	rootCmd.AddCommand(syncCmd())
 	rootCmd.AddCommand(runCmd())
+	rootCmd.AddCommand(pullCmd())
+	rootCmd.AddCommand(testCmd())
+	rootCmd.AddCommand(mapCmd())
+	rootCmd.AddCommand(submitCmd())
+	rootCmd.AddCommand(jobsCmd())
+	rootCmd.AddCommand(logsCmd())
+	rootCmd.AddCommand(killCmd())
+	rootCmd.AddCommand(taskCmd())
+	rootCmd.AddCommand(groupCmd())
 	rootCmd.AddCommand(configCmd())
 
-	if err := rootCmd.Execute(); err != nil {
+	// The first SIGINT or SIGTERM stops remote commands gracefully; a
+	// second one kills dw outright
+	ctx, cancel := context.WithCancelCause(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		// Cancel first: jobs whose local ssh already died are waiting on it
+		cancel(run.Interrupt{Signal: sig})
+		ui.Error(fmt.Sprintf("Received %s, stopping remote commands (repeat to force quit)", sig))
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if tr != nil {
+		tr.Close()
+	}
+
+	if err != nil {
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
+// exitError carries a specific process exit code out of a command
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e *exitError) Error() string {
+	return e.msg
+}
+
 func statusCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "status",
-		Short: "Show status of all hosts",
+		Short: "Show status of all hosts in the inventory",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var hosts []config.SSHHost
-			var err error
-
-			err = ui.Spin("Checking hosts", func() error {
-				hosts, err = config.ParseSSHConfig()
+			var view *inventory.View
+			err := ui.Spin("Checking hosts", func() error {
+				var err error
+				view, err = loadInventory()
 				return err
 			})
 
 			if err != nil {
-				return fmt.Errorf("failed to parse SSH config: %w", err)
+				return err
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "HOST\tSTATUS\tADDRESS")
+			aliases := make([]string, len(view.Hosts))
+			addresses := make(map[string]string, len(view.Hosts))
+			for i, h := range view.Hosts {
+				aliases[i] = h.Name
+				addresses[h.Name] = h.Address
+			}
 
-			for _, h := range hosts {
+			probe := host.ProbeOptions{Workers: workersFlag, Deadline: deadlineFlag}
+
+			if structured() {
+				doc := statusDoc{Hosts: []hostStatus{}}
+				for _, r := range host.CheckAll(cmd.Context(), tr, aliases, 2*time.Second, probe, nil) {
+					doc.Hosts = append(doc.Hosts, hostStatus{Host: r.Host, Address: addresses[r.Host], Reachable: r.Reachable})
+				}
+				return emit(doc)
+			}
+
+			// Rows are printed as hosts answer, so columns use fixed widths
+			width := columnWidth("HOST", aliases)
+			fmt.Printf("%-*s  %-9s  %s\n", width, "HOST", "STATUS", "ADDRESS")
+
+			host.CheckAll(cmd.Context(), tr, aliases, 2*time.Second, probe, func(r host.Reachability) {
 				status := "✓ online"
-				if !host.CheckReachable(h.Alias, 2*time.Second) {
+				if !r.Reachable {
 					status = "✗ offline"
 				}
-				fmt.Fprintf(w, "%s\t%s\t%s\n", h.Alias, status, h.Hostname)
-			}
+				fmt.Printf("%-*s  %-9s  %s\n", width, r.Host, status, addresses[r.Host])
+			})
 
-			return w.Flush()
+			return nil
 		},
 	}
 }
 
 func loadCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "load",
 		Short: "Show load across all hosts",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -90,21 +205,46 @@ func loadCmd() *cobra.Command {
 				return err
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "HOST\tLOAD\tCPUS\tCPU%\tMEM%\tSCORE")
+			opts, err := probeOptions()
+			if err != nil {
+				return err
+			}
+
+			ui.Info(fmt.Sprintf("Probing %d hosts", len(hosts)))
+
+			// Unreachable hosts are listed whatever their labels, since
+			// their detected labels are unknown
+			selected := func(info *host.LoadInfo) bool {
+				return !info.Reachable || opts.Selector.Matches(info.Labels)
+			}
+
+			if structured() {
+				doc := loadDoc{Hosts: []*host.LoadInfo{}}
+				for _, info := range host.ProbeAll(cmd.Context(), tr, hosts, opts, nil) {
+					if selected(info) {
+						doc.Hosts = append(doc.Hosts, info)
+					}
+				}
+				if best := bestOf(doc.Hosts); best != nil {
+					doc.Best = best.Host
+				}
+				return emit(doc)
+			}
+
+			// Rows are printed as hosts answer, so columns use fixed widths
+			width := columnWidth("HOST", hosts)
+			fmt.Printf("%-*s  %6s  %4s  %4s  %4s  %5s  %4s  %3s  %4s  %7s  %s\n",
+				width, "HOST", "LOAD", "CPUS", "CPU%", "MEM%", "DISK%", "SWP%", "IO%", "JOBS", "SCORE", "BREAKDOWN")
 
 			var best *host.LoadInfo
-			for _, h := range hosts {
-				var info *host.LoadInfo
-				err := ui.Spin(fmt.Sprintf("Checking %s", h), func() error {
-					var loadErr error
-					info, loadErr = host.GetLoad(h)
-					return loadErr
-				})
-
-				if err != nil || info == nil || !info.Reachable {
-					fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\n", h)
-					continue
+			host.ProbeAll(cmd.Context(), tr, hosts, opts, func(info *host.LoadInfo) {
+				if !selected(info) {
+					return
+				}
+				if !info.Reachable {
+					fmt.Printf("%-*s  %6s  %4s  %4s  %4s  %5s  %4s  %3s  %4s  %7s  %s\n",
+						width, info.Host, "-", "-", "-", "-", "-", "-", "-", "-", "-", "-")
+					return
 				}
 
 				marker := ""
@@ -113,13 +253,17 @@ func loadCmd() *cobra.Command {
 					marker = " ←"
 				}
 
-				fmt.Fprintf(w, "%s\t%.2f\t%d\t%d%%\t%d%%\t%.2f%s\n",
-					info.Host, info.Load, info.CPUs, info.CPUPct, info.MemPct, info.Score, marker)
-			}
+				fmt.Printf("%-*s  %6.2f  %4d  %3d%%  %3d%%  %4d%%  %3d%%  %2d%%  %4d  %7.2f  %s%s\n",
+					width, info.Host, info.Load, info.CPUs, info.CPUPct, info.MemPct, 100-info.DiskFreePct,
+					info.SwapPct, info.IOWaitPct, info.Jobs, info.Score, info.Breakdown(), marker)
+			})
 
-			return w.Flush()
+			return nil
 		},
 	}
+
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only use hosts whose labels match, e.g. `os=linux,arch=amd64`")
+	return cmd
 }
 
 func syncCmd() *cobra.Command {
@@ -142,56 +286,252 @@ func syncCmd() *cobra.Command {
 				ui.Info("Dry run - no files will be transferred")
 			}
 
-			err = sync.Push(path, hosts, dryRunFlag)
-			if err == nil {
-				ui.Success("Sync complete")
+			ctx, cancel := withTimeout(cmd.Context())
+			defer cancel()
+
+			hosts, err = selectHosts(ctx, hosts)
+			if err != nil {
+				return err
 			}
-			return err
+
+			layout, err := syncLayout()
+			if err != nil {
+				return err
+			}
+			if err := layout.Push(ctx, tr, path, hosts, dryRunFlag); err != nil {
+				if stopErr := stopError(ctx); stopErr != nil {
+					return stopErr
+				}
+				return err
+			}
+
+			if structured() {
+				return emit(syncDoc{Path: path, Hosts: hosts, DryRun: dryRunFlag})
+			}
+
+			ui.Success("Sync complete")
+			return nil
 		},
 	}
 
 	cmd.Flags().BoolVar(&dryRunFlag, "dry-run", false, "Show what would be synced")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Give up after this long (0 means no limit)")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only use hosts whose labels match, e.g. `os=linux,arch=amd64`")
 	return cmd
 }
 
 func runCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "run [command...]",
 		Short: "Run command on best host",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			command := strings.Join(args, " ")
 
+			ctx, cancel := withTimeout(cmd.Context())
+			defer cancel()
+
+			var doc runDoc
+			var err error
 			if allFlag {
-				hosts, err := getTargetHosts()
-				if err != nil {
-					return err
+				doc, err = runOnAll(ctx, cmd, command)
+			} else {
+				doc, err = runOnBest(ctx, cmd, command)
+			}
+
+			if structured() && doc.Results != nil {
+				if emitErr := emit(doc); emitErr != nil {
+					return emitErr
 				}
-				ui.Info(fmt.Sprintf("Running on all hosts: %s", strings.Join(hosts, ", ")))
-				return run.OnAll(hosts, command)
 			}
+			return err
+		},
+	}
 
-			// Run on best host
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Stop the command on every host after this long (0 means no limit)")
+	cmd.Flags().IntVar(&retriesFlag, "retries", 0, "Retry on the next best host up to `n` times when the connection fails")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only use hosts whose labels match, e.g. `os=linux,arch=amd64`")
+	cmd.Flags().StringArrayVar(&artifactsFlag, "artifacts", nil, "After a successful run, pull files matching `glob` back from the remote mirror (repeatable)")
+	cmd.Flags().StringArrayVar(&envFlag, "env", nil, "Set `KEY=VALUE` in the command's environment (repeatable)")
+
+	cmd.Flags().StringVar(&syncFlag, "sync", "", "Sync `path` to the chosen hosts first and run from its remote mirror")
+	cmd.Flags().Lookup("sync").NoOptDefVal = "."
+
+	cmd.Flags().IntVar(&parallelFlag, "parallel", 0, "With --all, run on at most `n` hosts at once (0 means all)")
+	cmd.Flags().IntVar(&batchSizeFlag, "batch-size", 0, "With --all, run in rolling batches of `n` hosts, each finishing before the next starts")
+	cmd.Flags().BoolVar(&serialFlag, "serial", false, "With --all, run on one host at a time (same as --batch-size 1)")
+	cmd.Flags().BoolVar(&failFastFlag, "fail-fast", false, "With --all, start no more hosts once one has failed")
+	cmd.Flags().BoolVar(&groupOutputFlag, "group-output", false, "With --all, print each host's output as a block when it finishes")
+	cmd.Flags().BoolVar(&noColorFlag, "no-color", false, "Disable per-host colors")
+	return cmd
+}
+
+func pullCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pull [glob...]",
+		Short: "Pull files back from remote hosts",
+		Long: "Pull files matching each glob from the remote mirror of --path back to the same local path. " +
+			"Without globs the whole mirror is pulled. With --all each host's files land in " + sync.ArtifactDir + "/<host>.",
+		RunE: func(cmd *cobra.Command, args []string) error {
 			hosts, err := getTargetHosts()
 			if err != nil {
 				return err
 			}
 
-			var best *host.LoadInfo
-			err = ui.Spin("Finding best host", func() error {
-				var findErr error
-				best, findErr = host.FindBest(hosts)
-				return findErr
-			})
+			if !allFlag && len(hosts) > 1 {
+				return fmt.Errorf("group %q has %d hosts; pick one with --host or pull from each with --all", groupFlag, len(hosts))
+			}
 
+			pulls, err := pullArtifacts(cmd.Context(), hosts, pathFlag, args, allFlag)
 			if err != nil {
 				return err
 			}
 
-			ui.Info(fmt.Sprintf("Running on %s (score: %.2f)", best.Host, best.Score))
-			return run.OnHost(best.Host, command)
+			if structured() {
+				return emit(pullDoc{Path: pathFlag, Patterns: args, Pulls: pulls})
+			}
+
+			ui.Success("Pull complete")
+			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&pathFlag, "path", ".", "Local directory whose remote mirror to pull from")
+	return cmd
+}
+
+// runOnAll runs command on every target host in parallel and prints a
+// summary, or with --output returns the document to emit
+func runOnAll(ctx context.Context, cmd *cobra.Command, command string) (runDoc, error) {
+	hosts, err := getTargetHosts()
+	if err != nil {
+		return runDoc{}, err
+	}
+
+	hosts, err = selectHosts(ctx, hosts)
+	if err != nil {
+		return runDoc{}, err
+	}
+
+	remoteCmd, err := remoteCommand(command)
+	if err != nil {
+		return runDoc{}, err
+	}
+	remoteCmd, dir, err := syncForRun(ctx, hosts, remoteCmd)
+	if err != nil {
+		return runDoc{}, err
+	}
+
+	ui.Info(fmt.Sprintf("Running on all hosts: %s", strings.Join(hosts, ", ")))
+	batchSize := batchSizeFlag
+	if serialFlag {
+		batchSize = 1
+	}
+
+	results := run.OnAll(ctx, tr, hosts, remoteCmd, run.Options{
+		GroupOutput: groupOutputFlag,
+		Color:       !noColorFlag && ui.ColorEnabled(),
+		Capture:     structured(),
+		Parallel:    parallelFlag,
+		BatchSize:   batchSize,
+		FailFast:    failFastFlag,
+	})
+
+	pulls, pullErr := runArtifacts(cmd.Context(), succeeded(results), true)
+	doc := runDoc{Command: command, Dir: dir, Results: results, Artifacts: pulls}
+
+	if !structured() {
+		if err := printResults(results); err != nil {
+			return doc, err
+		}
+	}
+
+	if err := resultsError(cmd, results); err != nil {
+		return doc, err
+	}
+	return doc, pullErr
+}
+
+// runOnBest runs command on the best host. With --retries, connection
+// failures re-rank the hosts not tried yet and retry on the next best.
+// With --output the command's output is captured into the returned
+// document instead of streamed.
+func runOnBest(ctx context.Context, cmd *cobra.Command, command string) (runDoc, error) {
+	hosts, err := getTargetHosts()
+	if err != nil {
+		return runDoc{}, err
+	}
+
+	opts, err := probeOptions()
+	if err != nil {
+		return runDoc{}, err
+	}
+
+	setupCmd, err := remoteCommand(command)
+	if err != nil {
+		return runDoc{}, err
+	}
+
+	// Every attempt is kept for --output; the last one decides the outcome
+	var attempts []run.Result
+	for try := 0; ; try++ {
+		var best *host.LoadInfo
+		err = ui.Spin("Finding best host", func() error {
+			var findErr error
+			best, findErr = host.FindBest(ctx, tr, hosts, opts)
+			return findErr
+		})
+
+		if err != nil {
+			if try > 0 {
+				return runDoc{}, fmt.Errorf("no host left to retry on: %w", err)
+			}
+			return runDoc{}, err
+		}
+
+		// Only the chosen host needs the files
+		remoteCmd, dir, err := syncForRun(ctx, []string{best.Host}, setupCmd)
+		if err != nil {
+			return runDoc{}, err
+		}
+
+		ui.Info(fmt.Sprintf("Running on %s (score: %.2f)", best.Host, best.Score))
+
+		var runErr error
+		if structured() {
+			results := run.OnAll(ctx, tr, []string{best.Host}, remoteCmd, run.Options{Capture: true})
+			attempts = append(attempts, results[0])
+			runErr = results[0].Err
+		} else {
+			runErr = run.OnHost(ctx, tr, best.Host, remoteCmd)
+		}
+
+		if runErr != nil && try < retriesFlag && ctx.Err() == nil && run.Retryable(runErr) {
+			ui.Error(fmt.Sprintf("Lost %s (%v), retrying on the next best host", best.Host, runErr))
+			hosts = slices.DeleteFunc(slices.Clone(hosts), func(h string) bool { return h == best.Host })
+			continue
+		}
+
+		if structured() {
+			last := attempts[len(attempts)-1:]
+			pulls, pullErr := runArtifacts(cmd.Context(), succeeded(last), false)
+			doc := runDoc{Command: command, Dir: dir, Best: best, Results: attempts, Artifacts: pulls}
+			if err := resultsError(cmd, last); err != nil {
+				return doc, err
+			}
+			return doc, pullErr
+		}
+
+		if runErr != nil {
+			if stopErr := stopError(ctx); stopErr != nil {
+				return runDoc{}, stopErr
+			}
+			return runDoc{}, runErr
+		}
+
+		_, err = runArtifacts(cmd.Context(), []string{best.Host}, false)
+		return runDoc{}, err
+	}
 }
 
 func configCmd() *cobra.Command {
@@ -221,6 +561,10 @@ func configCmd() *cobra.Command {
 			}
 
 			path, _ := config.ConfigPath()
+			if structured() {
+				return emit(configDoc{Path: path, Config: cfg})
+			}
+
 			fmt.Printf("✓ Configuration created at %s\n", path)
 			fmt.Printf("✓ Added %d hosts to 'dev' group\n", len(hosts))
 
@@ -230,16 +574,35 @@ func configCmd() *cobra.Command {
 
 	cmd.AddCommand(&cobra.Command{
 		Use:   "show",
-		Short: "Show current configuration",
+		Short: "Show the configuration in effect and where each setting comes from",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.Load()
+			cfg, err := loadConfig()
 			if err != nil {
 				return err
 			}
 
+			path, _ := config.ConfigPath()
+			if structured() {
+				return emit(configDoc{Path: path, Config: cfg.Config, Project: cfg.ProjectPath, Settings: cfg.Settings})
+			}
+
+			fmt.Printf("Config:  %s\n", path)
+			fmt.Printf("Project: %s\n", dash(cfg.ProjectPath))
+			fmt.Println()
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+			for _, s := range cfg.Settings {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, s.Value, s.Source)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Println()
 			fmt.Println("Groups:")
-			for group, hosts := range cfg.Groups {
-				fmt.Printf("  %s: %s\n", group, strings.Join(hosts, ", "))
+			for _, group := range slices.Sorted(maps.Keys(cfg.Groups)) {
+				fmt.Printf("  %s: %s\n", group, strings.Join(cfg.Groups[group], ", "))
 			}
 
 			return nil
@@ -249,6 +612,276 @@ func configCmd() *cobra.Command {
 	return cmd
 }
 
+// printResults writes a per-host summary table for a parallel run
+func printResults(results []run.Result) error {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tEXIT\tDURATION\tERROR")
+
+	for _, r := range results {
+		status := "✓ ok"
+		errMsg := "-"
+		if r.Failed() {
+			status = "✗ failed"
+			errMsg = r.Err.Error()
+		}
+		if r.Signal != "" {
+			status = "✗ " + r.Signal
+		}
+		if r.Canceled {
+			status = "✗ canceled"
+		}
+		if r.TimedOut {
+			status = "✗ timed out"
+		}
+		if r.Skipped {
+			status = "- skipped"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+			r.Host, status, r.ExitCode, r.Duration.Round(time.Millisecond), errMsg)
+	}
+
+	return w.Flush()
+}
+
+// syncForRun pushes --sync's path to hosts and returns the command to run
+// from the remote mirror along with that directory. Without --sync the
+// command is returned unchanged.
+func syncForRun(ctx context.Context, hosts []string, command string) (string, string, error) {
+	if syncFlag == "" {
+		return command, "", nil
+	}
+
+	layout, err := syncLayout()
+	if err != nil {
+		return "", "", err
+	}
+	_, dir, err := layout.MirrorPath(syncFlag)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := layout.Push(ctx, tr, syncFlag, hosts, false); err != nil {
+		return "", "", err
+	}
+
+	return remote.InDir(dir, command), dir, nil
+}
+
+// syncLayout returns how directories are mirrored on hosts: the sync
+// excludes in effect, and the .dw.yaml's directory mirrored at its
+// sync.remote_path if it sets one
+func syncLayout() (sync.Layout, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return sync.Layout{}, err
+	}
+	layout := sync.Layout{Exclude: cfg.Sync.Exclude}
+	if cfg.Sync.RemotePath != "" {
+		layout.Root, layout.RemoteRoot = cfg.Root(), cfg.Sync.RemotePath
+	}
+	return layout, nil
+}
+
+// runArtifacts pulls --artifacts back from hosts after a run, from the
+// mirror of the --sync path or the current directory. ctx is the
+// command's context rather than the run's: hosts that finished before a
+// timeout still have their files pulled, within a --timeout of their own,
+// while an interrupt stops the pulls too.
+func runArtifacts(ctx context.Context, hosts []string, perHost bool) ([]artifactPull, error) {
+	if len(artifactsFlag) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	localPath := "."
+	if syncFlag != "" {
+		localPath = syncFlag
+	}
+	return pullArtifacts(ctx, hosts, localPath, artifactsFlag, perHost)
+}
+
+// pullArtifacts pulls files matching patterns from each host's mirror of
+// localPath. With perHost every host gets its own subdirectory under
+// sync.ArtifactDir so files from different hosts don't overwrite each
+// other. Failed hosts are reported and the rest are still pulled, until
+// ctx is done.
+func pullArtifacts(ctx context.Context, hosts []string, localPath string, patterns []string, perHost bool) ([]artifactPull, error) {
+	layout, err := syncLayout()
+	if err != nil {
+		return nil, err
+	}
+	absPath, _, err := layout.MirrorPath(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var pulls []artifactPull
+	failed := 0
+	for _, h := range hosts {
+		dest := absPath
+		if perHost {
+			dest = filepath.Join(absPath, sync.ArtifactDir, h)
+		}
+
+		if err := layout.PullArtifacts(ctx, tr, h, localPath, dest, patterns); err != nil {
+			if stopErr := stopError(ctx); stopErr != nil {
+				return pulls, stopErr
+			}
+			ui.Error(err.Error())
+			failed++
+			continue
+		}
+		pulls = append(pulls, artifactPull{Host: h, Dest: dest})
+	}
+
+	if failed > 0 {
+		return pulls, fmt.Errorf("failed to pull from %d of %d hosts", failed, len(hosts))
+	}
+	return pulls, nil
+}
+
+// succeeded returns the hosts where the command succeeded
+func succeeded(results []run.Result) []string {
+	var hosts []string
+	for _, r := range results {
+		if !r.Failed() && !r.Skipped {
+			hosts = append(hosts, r.Host)
+		}
+	}
+	return hosts
+}
+
+// withTimeout applies --timeout to ctx
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeoutFlag <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeoutFlag)
+}
+
+// stopError explains why ctx stopped a command early, or returns nil
+func stopError(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeoutFlag)
+	}
+	return cause
+}
+
+// resultsError converts failed hosts into the exit code dw should use
+func resultsError(cmd *cobra.Command, results []run.Result) error {
+	code := run.ExitCode(results)
+	if code == 0 {
+		return nil
+	}
+
+	cmd.SilenceUsage = true
+	return &exitError{
+		code: code,
+		msg:  fmt.Sprintf("%d of %d hosts failed", len(run.Failures(results)), len(results)),
+	}
+}
+
+// bestOf returns the reachable host with the lowest score.
+// Ties go to the earlier host.
+func bestOf(infos []*host.LoadInfo) *host.LoadInfo {
+	var best *host.LoadInfo
+	for _, info := range infos {
+		if info.Reachable && (best == nil || info.Score < best.Score) {
+			best = info
+		}
+	}
+	return best
+}
+
+// probeOptions returns host probing limits and --selector from flags,
+// the scoring policy from config, host labels from the inventory, and
+// the facts cache
+func probeOptions() (host.ProbeOptions, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return host.ProbeOptions{}, err
+	}
+	view, err := loadInventory()
+	if err != nil {
+		return host.ProbeOptions{}, err
+	}
+
+	if err := host.ValidateScoring(cfg.Scoring); err != nil {
+		return host.ProbeOptions{}, err
+	}
+
+	selector, err := host.ParseSelector(selectorFlag)
+	if err != nil {
+		return host.ProbeOptions{}, err
+	}
+
+	ttl, err := cfg.Facts.CacheTTL()
+	if err != nil {
+		return host.ProbeOptions{}, err
+	}
+	facts, err := host.OpenFactsCache(ttl)
+	if err != nil {
+		return host.ProbeOptions{}, err
+	}
+
+	return host.ProbeOptions{
+		Workers:  workersFlag,
+		Deadline: deadlineFlag,
+		Scoring:  cfg.Scoring,
+		Labels:   view.Labels(),
+		Selector: selector,
+		Facts:    facts,
+	}, nil
+}
+
+// noHostsError explains why no host in the group can be used
+func noHostsError() error {
+	if selectorFlag != "" {
+		return fmt.Errorf("no reachable hosts in group %q match selector %q", groupFlag, selectorFlag)
+	}
+	return fmt.Errorf("no reachable hosts in group %q", groupFlag)
+}
+
+// selectHosts narrows hosts to the reachable ones matching --selector.
+// Without a selector hosts are returned as they are, unprobed.
+func selectHosts(ctx context.Context, hosts []string) ([]string, error) {
+	if selectorFlag == "" {
+		return hosts, nil
+	}
+
+	opts, err := probeOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, info := range host.ProbeAll(ctx, tr, hosts, opts, nil) {
+		if opts.Accepts(info) {
+			selected = append(selected, info.Host)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, noHostsError()
+	}
+
+	ui.Info(fmt.Sprintf("Selected %d of %d hosts matching %s", len(selected), len(hosts), selectorFlag))
+	return selected, nil
+}
+
+// columnWidth returns the width needed to align a column of values
+func columnWidth(header string, values []string) int {
+	width := len(header)
+	for _, v := range values {
+		width = max(width, len(v))
+	}
+	return width
+}
+
 // getTargetHosts returns the list of hosts to target based on flags
 func getTargetHosts() ([]string, error) {
 	// Specific host flag takes precedence
@@ -256,13 +889,20 @@ func getTargetHosts() ([]string, error) {
 		return []string{hostFlag}, nil
 	}
 
-	// Load config and get group
-	cfg, err := config.Load()
+	// Load config and get group from every inventory
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if groupFlag == "" {
+		groupFlag = cfg.Group
+	}
+	view, err := loadInventory()
 	if err != nil {
 		return nil, err
 	}
 
-	hosts, err := cfg.GetGroup(groupFlag)
+	hosts, err := view.Resolve(groupFlag, tailscaleTerms(cfg.Config))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/host"
+	"github.com/WillyV3/distributed/internal/remote"
+	"github.com/WillyV3/distributed/internal/run"
+	"github.com/WillyV3/distributed/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inputFlag   string
+	slotsFlag   int
+	resultsFlag string
+)
+
+func mapCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "map --input file -- command [{}]...",
+		Short: "Run a command once per input line, spread across hosts",
+		Long: "Run command once for every non-empty line of --input, like a distributed xargs -P. " +
+			"Each {} is replaced by the line, shell-quoted; without {} the line is appended. " +
+			"Each reachable host runs as many lines at once as it has CPUs (or --slots) and takes " +
+			"the next line as soon as one finishes.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			command := strings.Join(args, " ")
+
+			items, err := readItems(inputFlag)
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				return errors.New("no input lines")
+			}
+
+			ctx, cancel := withTimeout(cmd.Context())
+			defer cancel()
+
+			hosts, err := getTargetHosts()
+			if err != nil {
+				return err
+			}
+
+			opts, err := probeOptions()
+			if err != nil {
+				return err
+			}
+
+			ui.Info(fmt.Sprintf("Probing %d hosts", len(hosts)))
+			var workers []run.Worker
+			var workerHosts []string
+			for _, info := range host.ProbeAll(ctx, tr, hosts, opts, nil) {
+				if !opts.Accepts(info) {
+					continue
+				}
+				slots := slotsFlag
+				if slots <= 0 {
+					slots = max(info.CPUs, 1)
+				}
+				workers = append(workers, run.Worker{Host: info.Host, Slots: slots})
+				workerHosts = append(workerHosts, info.Host)
+			}
+			if len(workers) == 0 {
+				return noHostsError()
+			}
+
+			// Items go into the command alone, before setup and the cd
+			withSetup, err := setupWrapper()
+			if err != nil {
+				return err
+			}
+			_, dir, err := syncForRun(ctx, workerHosts, "")
+			if err != nil {
+				return err
+			}
+			wrap := func(expanded string) string {
+				if dir == "" {
+					return withSetup(expanded)
+				}
+				return remote.InDir(dir, withSetup(expanded))
+			}
+
+			if resultsFlag != "" {
+				if err := os.MkdirAll(resultsFlag, 0755); err != nil {
+					return fmt.Errorf("failed to create results directory: %w", err)
+				}
+			}
+
+			ui.Info(fmt.Sprintf("Mapping %d items over %d hosts", len(items), len(workers)))
+
+			var writeErr error
+			results := run.Map(ctx, tr, workers, command, wrap, items, func(r run.ItemResult) {
+				if resultsFlag != "" {
+					if err := writeItemResult(resultsFlag, r); err != nil && writeErr == nil {
+						writeErr = err
+					}
+				} else if !structured() {
+					io.WriteString(os.Stdout, r.Result.Stdout)
+					io.WriteString(os.Stderr, r.Result.Stderr)
+				}
+				if r.Result.Failed() && !structured() {
+					ui.Error(fmt.Sprintf("%s on %s %s", r.Item, r.Result.Host, r.Result.Summary()))
+				}
+			})
+			if writeErr != nil {
+				return writeErr
+			}
+
+			if structured() {
+				err = emit(mapDoc{Command: command, Dir: dir, Hosts: workers, Results: resultsFlag, Items: results})
+			} else {
+				err = printItemResults(results)
+			}
+			if err != nil {
+				return err
+			}
+
+			if stopErr := stopError(ctx); stopErr != nil {
+				return stopErr
+			}
+			return itemsError(cmd, results)
+		},
+	}
+
+	cmd.Flags().StringVar(&inputFlag, "input", "", "File with one item per line (- for stdin)")
+	cmd.MarkFlagRequired("input")
+	cmd.Flags().IntVar(&slotsFlag, "slots", 0, "Items each host runs at once (0 means one per CPU)")
+	cmd.Flags().StringVar(&resultsFlag, "results", "", "Write each item's item, stdout, stderr and exit files to `dir`/<n>/ instead of printing output")
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only use hosts whose labels match, e.g. `os=linux,arch=amd64`")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Stop every item still running after this long (0 means no limit)")
+	cmd.Flags().StringVar(&syncFlag, "sync", "", "Sync `path` to the hosts first and run from its remote mirror")
+	cmd.Flags().Lookup("sync").NoOptDefVal = "."
+	return cmd
+}
+
+// readItems returns the non-empty lines of path, or of stdin for "-"
+func readItems(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var items []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); strings.TrimSpace(line) != "" {
+			items = append(items, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	return items, nil
+}
+
+// writeItemResult saves an item's outcome under dir/<seq>: the item
+// itself, its output, and its exit code or the signal that killed it
+func writeItemResult(dir string, r run.ItemResult) error {
+	itemDir := filepath.Join(dir, strconv.Itoa(r.Seq))
+	if err := os.MkdirAll(itemDir, 0755); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+
+	exit := strconv.Itoa(r.Result.ExitCode)
+	if r.Result.Signal != "" {
+		exit = r.Result.Signal
+	}
+
+	files := map[string]string{
+		"item":   r.Item + "\n",
+		"stdout": r.Result.Stdout,
+		"stderr": r.Result.Stderr,
+		"exit":   exit + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(itemDir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+	}
+	return nil
+}
+
+// printItemResults prints a summary table of map items
+func printItemResults(results []run.ItemResult) error {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tITEM\tHOST\tSTATUS\tEXIT\tDURATION")
+
+	for _, item := range results {
+		r := item.Result
+		status := "✓ ok"
+		if r.Failed() {
+			status = "✗ failed"
+		}
+		if r.Signal != "" {
+			status = "✗ " + r.Signal
+		}
+		if r.Canceled {
+			status = "✗ canceled"
+		}
+		if r.TimedOut {
+			status = "✗ timed out"
+		}
+		if r.Skipped {
+			status = "- skipped"
+		}
+
+		host := r.Host
+		if host == "" {
+			host = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n",
+			item.Seq, item.Item, host, status, r.ExitCode, r.Duration.Round(time.Millisecond))
+	}
+
+	return w.Flush()
+}
+
+// itemsError converts failed items into the exit code dw should use.
+// Items that never ran, because every host was lost, count as failed.
+func itemsError(cmd *cobra.Command, items []run.ItemResult) error {
+	failed := 0
+	for _, item := range items {
+		if item.Result.Failed() || item.Result.Skipped {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+
+	code := run.ExitSomeFailed
+	if failed == len(items) {
+		code = run.ExitAllFailed
+	}
+
+	cmd.SilenceUsage = true
+	return &exitError{
+		code: code,
+		msg:  fmt.Sprintf("%d of %d items failed", failed, len(items)),
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"os"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/gotest"
+	"github.com/WillyV3/distributed/internal/host"
+	"github.com/WillyV3/distributed/internal/inventory"
+	"github.com/WillyV3/distributed/internal/jobs"
+	"github.com/WillyV3/distributed/internal/output"
+	"github.com/WillyV3/distributed/internal/remote"
+	"github.com/WillyV3/distributed/internal/run"
+)
+
+// Documents emitted by --output json|yaml. Field names are part of the
+// scripting interface, so only add to them.
+
+// statusDoc is the result of dw status
+type statusDoc struct {
+	Hosts []hostStatus `json:"hosts" yaml:"hosts"`
+}
+
+type hostStatus struct {
+	Host      string `json:"host" yaml:"host"`
+	Address   string `json:"address" yaml:"address"`
+	Reachable bool   `json:"reachable" yaml:"reachable"`
+}
+
+// loadDoc is the result of dw load
+type loadDoc struct {
+	Hosts []*host.LoadInfo `json:"hosts" yaml:"hosts"`
+	Best  string           `json:"best,omitempty" yaml:"best,omitempty"`
+}
+
+// runDoc is the result of dw run
+type runDoc struct {
+	Command   string         `json:"command" yaml:"command"`
+	Dir       string         `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Best      *host.LoadInfo `json:"best,omitempty" yaml:"best,omitempty"`
+	Results   []run.Result   `json:"results" yaml:"results"`
+	Artifacts []artifactPull `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+}
+
+// pullDoc is the result of dw pull
+type pullDoc struct {
+	Path     string         `json:"path" yaml:"path"`
+	Patterns []string       `json:"patterns,omitempty" yaml:"patterns,omitempty"`
+	Pulls    []artifactPull `json:"pulls" yaml:"pulls"`
+}
+
+// artifactPull records where one host's files were pulled to
+type artifactPull struct {
+	Host string `json:"host" yaml:"host"`
+	Dest string `json:"dest" yaml:"dest"`
+}
+
+// mapDoc is the result of dw map
+type mapDoc struct {
+	Command string           `json:"command" yaml:"command"`
+	Dir     string           `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Hosts   []run.Worker     `json:"hosts" yaml:"hosts"`
+	Results string           `json:"results,omitempty" yaml:"results,omitempty"`
+	Items   []run.ItemResult `json:"items" yaml:"items"`
+}
+
+// testDoc is the result of dw test
+type testDoc struct {
+	Shards   []gotest.Shard          `json:"shards" yaml:"shards"`
+	Packages []*gotest.PackageResult `json:"packages" yaml:"packages"`
+	Passed   bool                    `json:"passed" yaml:"passed"`
+}
+
+// jobsDoc is the result of dw jobs
+type jobsDoc struct {
+	Jobs []jobState `json:"jobs" yaml:"jobs"`
+}
+
+// jobState is a submitted job and what its host reports about it. Status
+// is running, exited, unknown, or unreachable when the host didn't answer.
+type jobState struct {
+	jobs.Job `yaml:",inline"`
+	Status   string `json:"status" yaml:"status"`
+	ExitCode *int   `json:"exit_code,omitempty" yaml:"exit_code,omitempty"`
+}
+
+func newJobState(j jobs.Job, statuses map[string]remote.JobStatus) jobState {
+	state := jobState{Job: j, Status: "unreachable"}
+	if s, ok := statuses[j.ID]; ok {
+		switch {
+		case s.Running:
+			state.Status = "running"
+		case s.Exited:
+			state.Status = "exited"
+			state.ExitCode = &s.ExitCode
+		default:
+			state.Status = "unknown"
+		}
+	}
+	return state
+}
+
+// factsDoc is the result of dw facts
+type factsDoc struct {
+	Hosts []hostFacts `json:"hosts" yaml:"hosts"`
+}
+
+// hostFacts is a host's facts, freshly collected when it is reachable and
+// the last cached ones otherwise
+type hostFacts struct {
+	Host      string            `json:"host" yaml:"host"`
+	Reachable bool              `json:"reachable" yaml:"reachable"`
+	Facts     *host.Facts       `json:"facts" yaml:"facts"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// inventoryDoc is the result of dw inventory
+type inventoryDoc struct {
+	Hosts  []*inventory.Host   `json:"hosts" yaml:"hosts"`
+	Groups map[string][]string `json:"groups" yaml:"groups"`
+}
+
+// groupsDoc is the result of dw group list
+type groupsDoc struct {
+	Groups []groupDoc `json:"groups" yaml:"groups"`
+}
+
+// groupDoc is a group as dw group create, add, remove and rename leave it,
+// or as it was before dw group delete
+type groupDoc struct {
+	Name  string   `json:"name" yaml:"name"`
+	Hosts []string `json:"hosts" yaml:"hosts"`
+}
+
+func newGroupDoc(cfg *config.Config, name string) groupDoc {
+	return groupDoc{Name: name, Hosts: cfg.Groups[name]}
+}
+
+// tailscaleDoc is the result of dw tailscale
+type tailscaleDoc struct {
+	Peers []tailscalePeer `json:"peers" yaml:"peers"`
+}
+
+// tailscalePeer is a tailnet peer and the host name dw uses for it
+type tailscalePeer struct {
+	Host    string   `json:"host" yaml:"host"`
+	Address string   `json:"address" yaml:"address"`
+	OS      string   `json:"os" yaml:"os"`
+	Tags    []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Online  bool     `json:"online" yaml:"online"`
+}
+
+// taskDoc is the result of running dw task: each task run, deps first,
+// up to the first one that failed
+type taskDoc struct {
+	Tasks []taskRun `json:"tasks" yaml:"tasks"`
+}
+
+// taskRun is one task's run document, or the hosts a task without a
+// command synced to
+type taskRun struct {
+	Task   string   `json:"task" yaml:"task"`
+	Run    *runDoc  `json:"run,omitempty" yaml:"run,omitempty"`
+	Synced []string `json:"synced,omitempty" yaml:"synced,omitempty"`
+}
+
+// tasksDoc is the result of dw task without a name
+type tasksDoc struct {
+	Tasks []taskInfo `json:"tasks" yaml:"tasks"`
+}
+
+// taskInfo is a task and the file defining it
+type taskInfo struct {
+	Name        string `json:"name" yaml:"name"`
+	config.Task `yaml:",inline"`
+	Source      string `json:"source" yaml:"source"`
+}
+
+// syncDoc is the result of dw sync
+type syncDoc struct {
+	Path   string   `json:"path" yaml:"path"`
+	Hosts  []string `json:"hosts" yaml:"hosts"`
+	DryRun bool     `json:"dry_run" yaml:"dry_run"`
+}
+
+// configDoc is the result of dw config show and dw config init. show
+// gives the config in effect, with the .dw.yaml applied and the source of
+// each project setting.
+type configDoc struct {
+	Path           string `json:"path" yaml:"path"`
+	*config.Config `yaml:",inline"`
+	Project        string           `json:"project,omitempty" yaml:"project,omitempty"`
+	Settings       []config.Setting `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// structured reports whether --output asked for a machine-readable document
+func structured() bool {
+	return outputFormat.Structured()
+}
+
+// emit writes a document to stdout in the --output format
+func emit(v any) error {
+	return output.Write(os.Stdout, outputFormat, v)
+}
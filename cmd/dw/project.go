@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/remote"
+)
+
+var (
+	effectiveOnce   sync.Once
+	effectiveConfig *config.Effective
+	effectiveErr    error
+)
+
+// loadConfig returns config.yaml with the .dw.yaml above the current
+// directory applied, read once per invocation
+func loadConfig() (*config.Effective, error) {
+	effectiveOnce.Do(func() {
+		effectiveConfig, effectiveErr = config.LoadEffective(".")
+	})
+	return effectiveConfig, effectiveErr
+}
+
+// remoteCommand returns command as it runs on the host: with --env
+// exported and the setup commands run first, from the same directory.
+// A failing setup command stops the rest.
+func remoteCommand(command string) (string, error) {
+	withSetup, err := setupWrapper()
+	if err != nil {
+		return "", err
+	}
+	return withSetup(command), nil
+}
+
+// setupWrapper returns the func remoteCommand applies, for commands built
+// one at a time such as those of dw map
+func setupWrapper() (func(command string) string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	commands := slices.Clone(cfg.Setup)
+	if len(envFlag) > 0 {
+		exports := make([]string, len(envFlag))
+		for i, kv := range envFlag {
+			name, value, ok := strings.Cut(kv, "=")
+			if !ok || !config.ValidEnvName(name) {
+				return nil, fmt.Errorf("invalid --env %q (want KEY=VALUE)", kv)
+			}
+			exports[i] = name + "=" + remote.Quote(value)
+		}
+		commands = slices.Insert(commands, 0, "export "+strings.Join(exports, " "))
+	}
+
+	return func(command string) string {
+		return remote.AfterSetup(commands, command)
+	}, nil
+}
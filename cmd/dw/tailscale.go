@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/tailscale"
+	"github.com/spf13/cobra"
+)
+
+var offlineFlag bool
+
+func tailscaleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tailscale",
+		Short: "List tailnet peers dw can use",
+		Long: "List the peers reported by tailscale status --json with their tags and OS, and the " +
+			"host name dw uses for each. Use them as a group with -g tailscale:all, " +
+			"tailscale:tag:<tag>, tailscale:os:<os> or tailscale:name:<peer>, or list those " +
+			"in a group in config.yaml.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			status, sshHosts, err := tailnet(cmd.Context(), cfg)
+			if err != nil {
+				return err
+			}
+
+			doc := tailscaleDoc{Peers: []tailscalePeer{}}
+			for _, p := range status.Peers() {
+				if !p.Online && !offlineFlag {
+					continue
+				}
+				doc.Peers = append(doc.Peers, tailscalePeer{
+					Host:    p.Alias(sshHosts),
+					Address: p.Address(),
+					OS:      p.OS,
+					Tags:    p.Tags,
+					Online:  p.Online,
+				})
+			}
+
+			if structured() {
+				return emit(doc)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "HOST\tSTATUS\tOS\tTAGS\tADDRESS")
+			for _, p := range doc.Peers {
+				status := "✓ online"
+				if !p.Online {
+					status = "✗ offline"
+				}
+				tags := strings.Join(p.Tags, ",")
+				if tags == "" {
+					tags = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Host, status, p.OS, tags, p.Address)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().BoolVar(&offlineFlag, "offline", false, "Include peers that are offline")
+	return cmd
+}
+
+// tailnet reads the tailnet status and the ssh config used to name its
+// peers, giving up after --probe-deadline
+func tailnet(ctx context.Context, cfg *config.Config) (*tailscale.Status, []config.SSHHost, error) {
+	ctx, cancel := context.WithTimeout(ctx, deadlineFlag)
+	defer cancel()
+
+	status, err := tailscale.Load(ctx, cfg.Tailscale)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Without an ssh config peers are still reachable by MagicDNS name
+	sshHosts, _ := config.ParseSSHConfig()
+	return status, sshHosts, nil
+}
+
+// tailscaleTerms resolves the tailscale: terms of a group or --group
+// expression to the online peers they select. The tailnet is only queried
+// once, and only if such a term is used.
+func tailscaleTerms(cfg *config.Config) func(term string) ([]string, bool, error) {
+	var (
+		status   *tailscale.Status
+		sshHosts []config.SSHHost
+	)
+	return func(term string) ([]string, bool, error) {
+		if !strings.HasPrefix(term, tailscale.GroupPrefix) {
+			return nil, false, nil
+		}
+		if status == nil {
+			var err error
+			if status, sshHosts, err = tailnet(context.Background(), cfg); err != nil {
+				return nil, true, err
+			}
+		}
+		hosts, err := tailscale.Resolve(status, term, sshHosts)
+		return hosts, true, err
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+func taskCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "task [name]",
+		Aliases: []string{"do"},
+		Short:   "Run a named task from config.yaml or .dw.yaml",
+		Long: "Run a task defined under tasks: in config.yaml or .dw.yaml, after the tasks it " +
+			"depends on. Each task runs like dw run with its own command, group, selector, sync " +
+			"path, env, timeout and artifacts. -g, --host, --all, --selector and --timeout override " +
+			"what the tasks set. Without a name, list the tasks.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 0 {
+				return listTasks(cfg)
+			}
+
+			order, err := config.TaskOrder(cfg.Tasks, args[0])
+			if err != nil {
+				return err
+			}
+
+			// Tasks set the run flags, so remember what was given
+			flags := taskOverrides{group: groupFlag, selector: selectorFlag, timeout: timeoutFlag, all: allFlag}
+
+			doc := taskDoc{Tasks: []taskRun{}}
+			var taskErr error
+			for _, name := range order {
+				if len(order) > 1 {
+					ui.Info(fmt.Sprintf("Task %s", name))
+				}
+				result, err := runTask(cmd, name, cfg.Tasks[name], flags)
+				doc.Tasks = append(doc.Tasks, result)
+				if err != nil {
+					taskErr = fmt.Errorf("task %s: %w", name, err)
+					break
+				}
+			}
+
+			if structured() {
+				if err := emit(doc); err != nil {
+					return err
+				}
+			}
+			return taskErr
+		},
+	}
+
+	cmd.Flags().StringVarP(&selectorFlag, "selector", "l", "", "Only use hosts whose labels match, e.g. `os=linux,arch=amd64`")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Stop each task after this long (0 means the task's own timeout)")
+	return cmd
+}
+
+// taskOverrides holds the flags given on the command line, which win over
+// what a task sets
+type taskOverrides struct {
+	group    string
+	selector string
+	timeout  time.Duration
+	all      bool
+}
+
+// runTask runs one task by setting the run flags from it, then syncing or
+// running its command the way dw run does. A task with neither only
+// stands for its deps.
+func runTask(cmd *cobra.Command, name string, task config.Task, flags taskOverrides) (taskRun, error) {
+	result := taskRun{Task: name}
+
+	timeout, err := task.TimeoutDuration()
+	if err != nil {
+		return result, err
+	}
+	groupFlag = cmp.Or(flags.group, task.Group)
+	selectorFlag = cmp.Or(flags.selector, task.Selector)
+	timeoutFlag = cmp.Or(flags.timeout, timeout)
+	allFlag = flags.all || task.All
+	syncFlag = task.Sync
+	artifactsFlag = task.Artifacts
+	envFlag = nil
+	for _, k := range slices.Sorted(maps.Keys(task.Env)) {
+		envFlag = append(envFlag, k+"="+task.Env[k])
+	}
+
+	ctx, cancel := withTimeout(cmd.Context())
+	defer cancel()
+
+	switch {
+	case task.Command != "":
+		var doc runDoc
+		if allFlag {
+			doc, err = runOnAll(ctx, cmd, task.Command)
+		} else {
+			doc, err = runOnBest(ctx, cmd, task.Command)
+		}
+		if doc.Results != nil {
+			result.Run = &doc
+		}
+		return result, err
+
+	case task.Sync != "":
+		hosts, err := getTargetHosts()
+		if err != nil {
+			return result, err
+		}
+		if hosts, err = selectHosts(ctx, hosts); err != nil {
+			return result, err
+		}
+		layout, err := syncLayout()
+		if err != nil {
+			return result, err
+		}
+		if err := layout.Push(ctx, tr, task.Sync, hosts, false); err != nil {
+			if stopErr := stopError(ctx); stopErr != nil {
+				return result, stopErr
+			}
+			return result, err
+		}
+		result.Synced = hosts
+		return result, nil
+	}
+
+	return result, nil
+}
+
+// listTasks prints every task and the file defining it
+func listTasks(cfg *config.Effective) error {
+	sources := make(map[string]string)
+	for _, s := range cfg.Settings {
+		if name, ok := strings.CutPrefix(s.Key, "tasks."); ok {
+			sources[name] = s.Source
+		}
+	}
+
+	if structured() {
+		doc := tasksDoc{Tasks: []taskInfo{}}
+		for _, name := range slices.Sorted(maps.Keys(cfg.Tasks)) {
+			doc.Tasks = append(doc.Tasks, taskInfo{Name: name, Task: cfg.Tasks[name], Source: sources[name]})
+		}
+		return emit(doc)
+	}
+
+	if len(cfg.Tasks) == 0 {
+		ui.Info("No tasks; add them under tasks: in .dw.yaml or config.yaml")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tCOMMAND\tDEPS\tSOURCE")
+	for _, name := range slices.Sorted(maps.Keys(cfg.Tasks)) {
+		t := cfg.Tasks[name]
+		command := t.Command
+		if command == "" && t.Sync != "" {
+			command = "(sync " + t.Sync + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, dash(command), dash(strings.Join(t.Deps, ", ")), sources[name])
+	}
+	return w.Flush()
+}
@@ -2,9 +2,14 @@ module github.com/WillyV3/distributed
 
 go 1.25.3
 
+require (
+	github.com/spf13/cobra v1.10.1
+	golang.org/x/crypto v0.43.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/cobra v1.10.1 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.37.0 // indirect
 )
@@ -2,15 +2,194 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the distributed config
 type Config struct {
-	Groups map[string][]string `yaml:"groups"`
+	Groups    map[string][]string `yaml:"groups" json:"groups"`
+	Hosts     map[string]Host     `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	Scoring   Scoring             `yaml:"scoring,omitempty" json:"scoring,omitzero"`
+	Facts     Facts               `yaml:"facts,omitempty" json:"facts,omitzero"`
+	Tailscale Tailscale           `yaml:"tailscale,omitempty" json:"tailscale,omitzero"`
+	Inventory []InventorySource   `yaml:"inventory,omitempty" json:"inventory,omitempty"`
+	// Project settings apply in every directory without a .dw.yaml
+	// overriding them
+	Project `yaml:",inline"`
+
+	// renamed maps groups in the file to the names RenameGroup gave them,
+	// so Save can rename them in place
+	renamed map[string]string
+}
+
+// InventorySource names an extra place hosts and groups come from. Exactly
+// one field is set.
+type InventorySource struct {
+	// INI is an Ansible-style INI inventory file
+	INI string `yaml:"ini,omitempty" json:"ini,omitempty"`
+	// Script is an executable printing Ansible-style JSON for --list
+	Script string `yaml:"script,omitempty" json:"script,omitempty"`
+}
+
+// Validate checks that exactly one kind of source is set
+func (s InventorySource) Validate() error {
+	if (s.INI == "") == (s.Script == "") {
+		return fmt.Errorf("inventory source needs exactly one of ini or script")
+	}
+	return nil
+}
+
+// Path returns the source's file with a leading ~ expanded
+func (s InventorySource) Path() string {
+	if s.INI != "" {
+		return expandHome(s.INI)
+	}
+	return expandHome(s.Script)
+}
+
+// Tailscale configures tailnet discovery
+type Tailscale struct {
+	// Command is the tailscale CLI; empty means "tailscale" from PATH
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+	// StatusFile is saved tailscale status --json output to read
+	// instead of running the CLI
+	StatusFile string `yaml:"status_file,omitempty" json:"status_file,omitempty"`
+}
+
+// CLI returns the tailscale command to run
+func (t Tailscale) CLI() string {
+	if t.Command == "" {
+		return "tailscale"
+	}
+	return t.Command
+}
+
+// StatusPath returns StatusFile with a leading ~ expanded
+func (t Tailscale) StatusPath() string {
+	return expandHome(t.StatusFile)
+}
+
+// DefaultFactsTTL is how long collected host facts are trusted before
+// they are collected again
+const DefaultFactsTTL = 24 * time.Hour
+
+// Facts configures the host facts cache
+type Facts struct {
+	// TTL is a duration such as "12h"; empty means DefaultFactsTTL
+	TTL string `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+}
+
+// CacheTTL returns how long facts stay fresh
+func (f Facts) CacheTTL() (time.Duration, error) {
+	if f.TTL == "" {
+		return DefaultFactsTTL, nil
+	}
+	ttl, err := time.ParseDuration(f.TTL)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("invalid facts ttl %q", f.TTL)
+	}
+	return ttl, nil
+}
+
+// Host holds settings for one host, keyed by its ssh alias. Address, User
+// and Port let dw reach hosts that aren't in ~/.ssh/config, and override
+// it for those that are.
+type Host struct {
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+	User    string `yaml:"user,omitempty" json:"user,omitempty"`
+	Port    string `yaml:"port,omitempty" json:"port,omitempty"`
+	// Labels describe the host for --selector, e.g. docker: "true".
+	// They override labels of the same name that dw detects.
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// Validate checks that the port is a number and that label names can be
+// used in a selector
+func (h Host) Validate() error {
+	if h.Port != "" {
+		if _, err := strconv.Atoi(h.Port); err != nil {
+			return fmt.Errorf("invalid port %q", h.Port)
+		}
+	}
+	for name := range h.Labels {
+		if !ValidLabelName(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// ValidLabelName reports whether name can be used in a selector
+func ValidLabelName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ",=! ")
+}
+
+// Scoring metrics that can be weighted. Each is a value where lower is
+// better: percentages for cpu, mem, disk (used), swap and iowait, and a
+// count of running dw jobs for jobs.
+const (
+	MetricCPU    = "cpu"
+	MetricMem    = "mem"
+	MetricDisk   = "disk"
+	MetricSwap   = "swap"
+	MetricIOWait = "iowait"
+	MetricJobs   = "jobs"
+)
+
+// Metrics lists every scoring metric in display order
+var Metrics = []string{MetricCPU, MetricMem, MetricDisk, MetricSwap, MetricIOWait, MetricJobs}
+
+// DefaultWeights reproduces the original (CPU% × 0.7) + (Memory% × 0.3) score
+var DefaultWeights = map[string]float64{
+	MetricCPU: 0.7,
+	MetricMem: 0.3,
+}
+
+// Scoring configures how host metrics are combined into a load score
+type Scoring struct {
+	// Weights per metric; unset metrics keep their default weight
+	Weights map[string]float64 `yaml:"weights,omitempty" json:"weights,omitempty"`
+	// Hosts adjusts the final score of individual hosts
+	Hosts map[string]HostScoring `yaml:"hosts,omitempty" json:"hosts,omitempty"`
+	// Labels adjusts the final score of every host matching a label
+	// selector, e.g. "arch=arm64" or "!docker"
+	Labels map[string]HostScoring `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// HostScoring adjusts one host's score as score × Weight + Bias
+type HostScoring struct {
+	Weight float64 `yaml:"weight,omitempty" json:"weight,omitempty"`
+	Bias   float64 `yaml:"bias,omitempty" json:"bias,omitempty"`
+}
+
+// EffectiveWeights returns the configured weights merged over the defaults
+func (s Scoring) EffectiveWeights() map[string]float64 {
+	weights := make(map[string]float64, len(Metrics))
+	for metric, w := range DefaultWeights {
+		weights[metric] = w
+	}
+	for metric, w := range s.Weights {
+		weights[metric] = w
+	}
+	return weights
+}
+
+// Validate checks that only known metrics are weighted
+func (s Scoring) Validate() error {
+	for metric := range s.Weights {
+		if !slices.Contains(Metrics, metric) {
+			return fmt.Errorf("unknown scoring metric %q (want one of %v)", metric, Metrics)
+		}
+	}
+	return nil
 }
 
 // DefaultConfig returns a sensible default configuration
@@ -57,6 +236,29 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	if err := cfg.Scoring.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if _, err := cfg.Facts.CacheTTL(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	for name, h := range cfg.Hosts {
+		if err := h.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config %s: host %s: %w", path, name, err)
+		}
+	}
+	if err := validateTasks(cfg.Tasks); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if cfg.Sync.RemotePath != "" {
+		return nil, fmt.Errorf("invalid config %s: sync.remote_path can only be set in %s", path, ProjectFile)
+	}
+	for _, source := range cfg.Inventory {
+		if err := source.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+
 	return &cfg, nil
 }
 
@@ -73,7 +275,13 @@ func Save(cfg *Config) error {
 		return err
 	}
 
-	data, err := yaml.Marshal(cfg)
+	// Keep the comments and ordering of the file being replaced
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	data, err := encode(cfg, existing)
 	if err != nil {
 		return err
 	}
@@ -81,19 +289,196 @@ func Save(cfg *Config) error {
 	return os.WriteFile(path, data, 0644)
 }
 
-// GetGroup returns hosts in a group
+// GetGroup returns the hosts in a group, expanding references to other
+// groups, globs and exclusions
 func (c *Config) GetGroup(name string) ([]string, error) {
-	hosts, ok := c.Groups[name]
+	r := &GroupResolver{Groups: c.Groups, Hosts: slices.Sorted(maps.Keys(c.Hosts))}
+	return r.Group(name)
+}
+
+// entries returns a group's terms as written
+func (c *Config) entries(name string) ([]string, error) {
+	terms, ok := c.Groups[name]
 	if !ok {
 		return nil, fmt.Errorf("group %q not found", name)
 	}
-	return hosts, nil
+	return terms, nil
 }
 
-// AddToGroup adds a host to a group
-func (c *Config) AddToGroup(group, host string) {
+// AddToGroup adds a host to a group, creating the group if needed. It
+// reports false if the host was already in the group.
+func (c *Config) AddToGroup(group, host string) bool {
 	if c.Groups == nil {
 		c.Groups = make(map[string][]string)
 	}
+	if slices.Contains(c.Groups[group], host) {
+		return false
+	}
 	c.Groups[group] = append(c.Groups[group], host)
+	return true
+}
+
+// RemoveFromGroup removes a host from a group
+func (c *Config) RemoveFromGroup(group, host string) error {
+	hosts, err := c.entries(group)
+	if err != nil {
+		return err
+	}
+	i := slices.Index(hosts, host)
+	if i < 0 {
+		return fmt.Errorf("host %q is not in group %q", host, group)
+	}
+	c.Groups[group] = slices.Delete(hosts, i, i+1)
+	return nil
+}
+
+// CreateGroup adds an empty group
+func (c *Config) CreateGroup(name string) error {
+	if err := ValidateGroupName(name); err != nil {
+		return err
+	}
+	if _, ok := c.Groups[name]; ok {
+		return fmt.Errorf("group %q already exists", name)
+	}
+	if c.Groups == nil {
+		c.Groups = make(map[string][]string)
+	}
+	c.Groups[name] = []string{}
+	return nil
+}
+
+// DeleteGroup removes a group and returns the hosts it had. A group
+// other groups or the default group still refer to can't be deleted; see
+// DropReferences.
+func (c *Config) DeleteGroup(name string) ([]string, error) {
+	hosts, err := c.entries(name)
+	if err != nil {
+		return nil, err
+	}
+	if users := c.Referrers(name); len(users) > 0 {
+		return nil, fmt.Errorf("group %q is used by %s", name, strings.Join(users, ", "))
+	}
+	if ExpressionUses(c.Group, name) {
+		return nil, fmt.Errorf("group %q is used by the default group %q", name, c.Group)
+	}
+	delete(c.Groups, name)
+	return hosts, nil
+}
+
+// DropReferences removes @name and !@name from every other group, and
+// name from the default group, and returns the groups changed
+func (c *Config) DropReferences(name string) []string {
+	users := c.Referrers(name)
+	for _, group := range users {
+		c.Groups[group] = slices.DeleteFunc(c.Groups[group], func(term string) bool {
+			return strings.TrimPrefix(term, "!") == "@"+name
+		})
+	}
+
+	if ExpressionUses(c.Group, name) {
+		terms := slices.DeleteFunc(strings.Split(c.Group, ","), func(term string) bool {
+			return expressionTermUses(term, name)
+		})
+		c.Group = strings.Join(terms, ",")
+	}
+	return users
+}
+
+// RenameGroup gives a group a new name, in the groups and the default
+// group referring to it too
+func (c *Config) RenameGroup(from, to string) error {
+	hosts, err := c.entries(from)
+	if err != nil {
+		return err
+	}
+	if err := ValidateGroupName(to); err != nil {
+		return err
+	}
+	if _, ok := c.Groups[to]; ok {
+		return fmt.Errorf("group %q already exists", to)
+	}
+
+	for _, group := range c.Referrers(from) {
+		for i, term := range c.Groups[group] {
+			if negated, ok := strings.CutPrefix(term, "!"); ok && negated == "@"+from {
+				c.Groups[group][i] = "!@" + to
+			} else if term == "@"+from {
+				c.Groups[group][i] = "@" + to
+			}
+		}
+	}
+	delete(c.Groups, from)
+	c.Groups[to] = hosts
+
+	if ExpressionUses(c.Group, from) {
+		terms := strings.Split(c.Group, ",")
+		for i, term := range terms {
+			if expressionTermUses(term, from) {
+				terms[i] = strings.TrimSuffix(strings.TrimSpace(term), from) + to
+			}
+		}
+		c.Group = strings.Join(terms, ",")
+	}
+
+	c.trackRename(from, to)
+	return nil
+}
+
+// trackRename records that the group now named from is called to, keyed
+// by its name in the file
+func (c *Config) trackRename(from, to string) {
+	for original, name := range c.renamed {
+		if name == from {
+			c.renamed[original] = to
+			return
+		}
+	}
+	if _, ok := c.renamed[from]; ok {
+		// from was created after the file's group of that name was renamed
+		return
+	}
+	if c.renamed == nil {
+		c.renamed = make(map[string]string)
+	}
+	c.renamed[from] = to
+}
+
+// ExpressionUses reports whether a --group expression such as the
+// default group names the group name, included or excluded
+func ExpressionUses(expr, name string) bool {
+	return slices.ContainsFunc(strings.Split(expr, ","), func(term string) bool {
+		return expressionTermUses(term, name)
+	})
+}
+
+// expressionTermUses reports whether one term of an expression names the
+// group name: as name, @name, !name or !@name
+func expressionTermUses(term, name string) bool {
+	term = strings.TrimPrefix(strings.TrimSpace(term), "!")
+	return strings.TrimPrefix(term, "@") == name
+}
+
+// Referrers returns the other groups that refer to name, sorted
+func (c *Config) Referrers(name string) []string {
+	var users []string
+	for _, group := range slices.Sorted(maps.Keys(c.Groups)) {
+		if group == name {
+			continue
+		}
+		if slices.ContainsFunc(c.Groups[group], func(term string) bool {
+			return strings.TrimPrefix(term, "!") == "@"+name
+		}) {
+			users = append(users, group)
+		}
+	}
+	return users
+}
+
+// ValidateGroupName checks that name can be used with --group. Names
+// can't start with tailscale:, which selects tailnet peers instead.
+func ValidateGroupName(name string) error {
+	if name == "" || strings.ContainsAny(name, ",!@*? \t") || strings.HasPrefix(name, "tailscale:") {
+		return fmt.Errorf("invalid group name %q", name)
+	}
+	return nil
 }
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddToGroup(t *testing.T) {
+	cfg := &Config{}
+
+	if !cfg.AddToGroup("dev", "homelab") {
+		t.Error("Expected first add to report true")
+	}
+	if cfg.AddToGroup("dev", "homelab") {
+		t.Error("Expected duplicate add to report false")
+	}
+	cfg.AddToGroup("dev", "build-server")
+
+	if want := []string{"homelab", "build-server"}; !reflect.DeepEqual(cfg.Groups["dev"], want) {
+		t.Errorf("Expected %v, got %v", want, cfg.Groups["dev"])
+	}
+}
+
+func TestGroupEdits(t *testing.T) {
+	cfg := &Config{Groups: map[string][]string{"dev": {"homelab", "sonia-mac"}}}
+
+	if err := cfg.CreateGroup("build"); err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	if err := cfg.CreateGroup("build"); err == nil {
+		t.Error("Expected error creating an existing group")
+	}
+	for _, name := range []string{"", "a,b", "!dev", "@dev", "build-*", "two words", "tailscale:tag:x"} {
+		if err := cfg.CreateGroup(name); err == nil {
+			t.Errorf("Expected error for group name %q", name)
+		}
+	}
+
+	if err := cfg.RemoveFromGroup("dev", "sonia-mac"); err != nil {
+		t.Fatalf("RemoveFromGroup failed: %v", err)
+	}
+	if err := cfg.RemoveFromGroup("dev", "sonia-mac"); err == nil {
+		t.Error("Expected error removing a host not in the group")
+	}
+	if err := cfg.RemoveFromGroup("missing", "homelab"); err == nil {
+		t.Error("Expected error removing from a missing group")
+	}
+
+	if err := cfg.RenameGroup("dev", "build"); err == nil {
+		t.Error("Expected error renaming onto an existing group")
+	}
+	if err := cfg.RenameGroup("dev", "lab"); err != nil {
+		t.Fatalf("RenameGroup failed: %v", err)
+	}
+
+	hosts, err := cfg.DeleteGroup("build")
+	if err != nil || len(hosts) != 0 {
+		t.Fatalf("DeleteGroup() = %v, %v", hosts, err)
+	}
+	if _, err := cfg.DeleteGroup("build"); err == nil {
+		t.Error("Expected error deleting a missing group")
+	}
+
+	if want := map[string][]string{"lab": {"homelab"}}; !reflect.DeepEqual(cfg.Groups, want) {
+		t.Errorf("Expected groups %v, got %v", want, cfg.Groups)
+	}
+}
+
+func TestGroupEdits_References(t *testing.T) {
+	cfg := &Config{Groups: map[string][]string{
+		"build": {"build-*"},
+		"dev":   {"@build", "laptop"},
+		"ci":    {"@all", "!@build"},
+		"all":   {"*"},
+	}}
+
+	if err := cfg.RenameGroup("build", "builders"); err != nil {
+		t.Fatalf("RenameGroup failed: %v", err)
+	}
+	want := map[string][]string{
+		"builders": {"build-*"},
+		"dev":      {"@builders", "laptop"},
+		"ci":       {"@all", "!@builders"},
+		"all":      {"*"},
+	}
+	if !reflect.DeepEqual(cfg.Groups, want) {
+		t.Errorf("Expected references renamed, got %v", cfg.Groups)
+	}
+
+	if _, err := cfg.DeleteGroup("builders"); err == nil || !strings.Contains(err.Error(), "ci, dev") {
+		t.Errorf("Expected deleting a referenced group to fail naming its users, got %v", err)
+	}
+	if users := cfg.DropReferences("builders"); !reflect.DeepEqual(users, []string{"ci", "dev"}) {
+		t.Errorf("Expected references dropped from ci and dev, got %v", users)
+	}
+	if _, err := cfg.DeleteGroup("builders"); err != nil {
+		t.Fatalf("DeleteGroup failed: %v", err)
+	}
+	want = map[string][]string{"dev": {"laptop"}, "ci": {"@all"}, "all": {"*"}}
+	if !reflect.DeepEqual(cfg.Groups, want) {
+		t.Errorf("Expected groups %v, got %v", want, cfg.Groups)
+	}
+}
+
+func TestGroupEdits_DefaultGroup(t *testing.T) {
+	cfg := &Config{
+		Project: Project{Group: "build, !@slow"},
+		Groups: map[string][]string{
+			"build": {"build-*"},
+			"slow":  {"pi"},
+		},
+	}
+
+	if err := cfg.RenameGroup("build", "builders"); err != nil {
+		t.Fatalf("RenameGroup failed: %v", err)
+	}
+	if err := cfg.RenameGroup("slow", "arm"); err != nil {
+		t.Fatalf("RenameGroup failed: %v", err)
+	}
+	if cfg.Group != "builders,!@arm" {
+		t.Errorf("Expected the default group renamed, got %q", cfg.Group)
+	}
+
+	if _, err := cfg.DeleteGroup("arm"); err == nil || !strings.Contains(err.Error(), "default group") {
+		t.Errorf("Expected deleting a group the default group uses to fail, got %v", err)
+	}
+	cfg.DropReferences("arm")
+	if cfg.Group != "builders" {
+		t.Errorf("Expected arm dropped from the default group, got %q", cfg.Group)
+	}
+	if _, err := cfg.DeleteGroup("arm"); err != nil {
+		t.Fatalf("DeleteGroup failed: %v", err)
+	}
+}
+
+func TestSave_KeepsComments(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	original := `# Machines I build on
+groups:
+  # Everyday hosts
+  dev:
+    - homelab # 32 cores
+    - sonia-mac
+  build: []
+hosts:
+  homelab:
+    labels:
+      docker: "true"
+      gpu: yes # RTX 3090
+scoring:
+  weights:
+    cpu: 0.6
+`
+	path := filepath.Join(home, ".config", "distributed", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	cfg.RemoveFromGroup("dev", "sonia-mac")
+	cfg.AddToGroup("dev", "build-server")
+	cfg.AddToGroup("build", "homelab")
+	cfg.CreateGroup("new")
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+
+	want := `# Machines I build on
+groups:
+  # Everyday hosts
+  dev:
+    - homelab # 32 cores
+    - build-server
+  build:
+    - homelab
+  new: []
+hosts:
+  homelab:
+    labels:
+      docker: "true"
+      gpu: yes # RTX 3090
+scoring:
+  weights:
+    cpu: 0.6
+`
+	if got != want {
+		t.Errorf("Unexpected file after save:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The result still loads to the same config
+	reloaded, err := Load()
+	if err != nil {
+		t.Fatalf("Load after save failed: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded.Groups, cfg.Groups) || !reflect.DeepEqual(reloaded.Hosts, cfg.Hosts) {
+		t.Errorf("Reloaded config differs: %+v", reloaded)
+	}
+	if strings.Contains(got, "facts") {
+		t.Error("Expected unset sections to stay out of the file")
+	}
+}
+
+func TestSave_RenameKeepsPlace(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	original := `groups:
+  # Everyday hosts
+  dev:
+    - homelab
+  lab:
+    - "@dev" # and the rest
+  ci: []
+`
+	path := filepath.Join(home, ".config", "distributed", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.RenameGroup("dev", "daily"); err != nil {
+		t.Fatalf("RenameGroup failed: %v", err)
+	}
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `groups:
+  # Everyday hosts
+  daily:
+    - homelab
+  lab:
+    - "@daily" # and the rest
+  ci: []
+`
+	if got := string(data); got != want {
+		t.Errorf("Unexpected file after rename:\n%s\nwant:\n%s", got, want)
+	}
+}
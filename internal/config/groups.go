@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// GroupResolver expands groups into hosts. A group lists terms:
+//
+//	homelab        a host
+//	@linux         every host of another group
+//	build-*        every known host matching a glob (*, ? and [...])
+//	!sonia-mac     removes what the rest of the term selects, e.g.
+//	               !@laptops or !build-3
+//
+// Hosts selected by any term, minus those any ! term selects, make up
+// the group, in the order they are first named.
+type GroupResolver struct {
+	Groups map[string][]string
+	// Hosts lists the known hosts globs and expressions match, along
+	// with the hosts named in Groups
+	Hosts []string
+	// External, if set, resolves terms dw expands elsewhere, such as
+	// tailscale: groups. It reports false for terms it doesn't handle.
+	External func(term string) ([]string, bool, error)
+}
+
+// Group returns the hosts of the named group
+func (r *GroupResolver) Group(name string) ([]string, error) {
+	return r.group(name, nil)
+}
+
+// Expression returns the hosts selected by a comma-separated list of
+// terms as given to --group, e.g. "dev,!laptop". Here a bare name is a
+// group if one has that name, and otherwise a known host.
+func (r *GroupResolver) Expression(expr string) ([]string, error) {
+	return r.resolve(strings.Split(expr, ","), nil, true)
+}
+
+func (r *GroupResolver) group(name string, stack []string) ([]string, error) {
+	if slices.Contains(stack, name) {
+		return nil, fmt.Errorf("group cycle: %s", strings.Join(append(stack, name), " -> "))
+	}
+	terms, ok := r.Groups[name]
+	if !ok {
+		return nil, fmt.Errorf("group %q not found", name)
+	}
+	return r.resolve(terms, append(stack, name), false)
+}
+
+// resolve combines terms; stack holds the groups being expanded, to catch
+// groups that include themselves
+func (r *GroupResolver) resolve(terms []string, stack []string, expression bool) ([]string, error) {
+	var include, exclude []string
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		negate := strings.HasPrefix(term, "!")
+		term = strings.TrimPrefix(term, "!")
+		if term == "" {
+			continue
+		}
+
+		hosts, err := r.term(term, stack, expression, negate)
+		if err != nil {
+			return nil, err
+		}
+		if negate {
+			exclude = append(exclude, hosts...)
+			continue
+		}
+		for _, h := range hosts {
+			if !slices.Contains(include, h) {
+				include = append(include, h)
+			}
+		}
+	}
+
+	return slices.DeleteFunc(include, func(h string) bool {
+		return slices.Contains(exclude, h)
+	}), nil
+}
+
+// term returns the hosts one term selects. In an expression a bare name
+// that is neither a group nor a known host is an error, unless it is being
+// excluded: it may still name a host that a tailscale: term selects.
+func (r *GroupResolver) term(term string, stack []string, expression, negate bool) ([]string, error) {
+	if r.External != nil {
+		if hosts, ok, err := r.External(term); ok || err != nil {
+			return hosts, err
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(term, "@"):
+		return r.group(strings.TrimPrefix(term, "@"), stack)
+
+	case strings.ContainsAny(term, "*?["):
+		var matched []string
+		for _, h := range r.known() {
+			ok, err := path.Match(term, h)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", term, err)
+			}
+			if ok {
+				matched = append(matched, h)
+			}
+		}
+		return matched, nil
+
+	case expression:
+		if _, ok := r.Groups[term]; ok {
+			return r.group(term, stack)
+		}
+		if negate || slices.Contains(r.known(), term) {
+			return []string{term}, nil
+		}
+		return nil, fmt.Errorf("group %q not found", term)
+
+	default:
+		return []string{term}, nil
+	}
+}
+
+// known returns Hosts followed by the hosts named in Groups, in a stable
+// order so globs select hosts the same way every time
+func (r *GroupResolver) known() []string {
+	hosts := slices.Clone(r.Hosts)
+	for _, name := range slices.Sorted(maps.Keys(r.Groups)) {
+		for _, term := range r.Groups[name] {
+			if !strings.ContainsAny(term, "@!*?[:") && !slices.Contains(hosts, term) {
+				hosts = append(hosts, term)
+			}
+		}
+	}
+	return hosts
+}
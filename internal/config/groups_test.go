@@ -0,0 +1,120 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testGroups = map[string][]string{
+	"linux":  {"homelab", "build-1", "build-2"},
+	"macs":   {"sonia-mac"},
+	"dev":    {"@linux", "@macs", "!build-2"},
+	"build":  {"build-*", "!@macs"},
+	"nested": {"@dev", "laptop"},
+	"cycle":  {"@loop"},
+	"loop":   {"homelab", "@cycle"},
+	"bad":    {"@missing"},
+	"glob":   {"[build"},
+}
+
+func TestGroupResolver_Group(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   string
+		want    []string
+		wantErr string
+	}{
+		{name: "plain", group: "linux", want: []string{"homelab", "build-1", "build-2"}},
+		{name: "references and exclusion", group: "dev", want: []string{"homelab", "build-1", "sonia-mac"}},
+		{name: "glob over known hosts", group: "build", want: []string{"build-3", "build-1", "build-2"}},
+		{name: "nested twice", group: "nested", want: []string{"homelab", "build-1", "sonia-mac", "laptop"}},
+		{name: "cycle", group: "cycle", wantErr: "group cycle: cycle -> loop -> cycle"},
+		{name: "missing reference", group: "bad", wantErr: `group "missing" not found`},
+		{name: "missing group", group: "nope", wantErr: `group "nope" not found`},
+		{name: "bad pattern", group: "glob", wantErr: "invalid pattern"},
+	}
+
+	r := &GroupResolver{Groups: testGroups, Hosts: []string{"build-3"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Group(tt.group)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Group(%q) failed: %v", tt.group, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGroupResolver_Expression(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    []string
+		wantErr string
+	}{
+		{name: "group", expr: "macs", want: []string{"sonia-mac"}},
+		{name: "group minus host", expr: "linux,!homelab", want: []string{"build-1", "build-2"}},
+		{name: "spaces", expr: " macs , build-3 ", want: []string{"sonia-mac", "build-3"}},
+		{name: "exclusion first", expr: "!build-*,@linux", want: []string{"homelab"}},
+		{name: "external", expr: "tailscale:all,!pixel", want: []string{"peer-a"}},
+		{name: "unknown name", expr: "dev,typo", wantErr: `group "typo" not found`},
+		{name: "external error", expr: "tailscale:bad:x", wantErr: "bad filter"},
+	}
+
+	r := &GroupResolver{
+		Groups: testGroups,
+		Hosts:  []string{"build-3"},
+		External: func(term string) ([]string, bool, error) {
+			switch term {
+			case "tailscale:all":
+				return []string{"peer-a", "pixel"}, true, nil
+			case "tailscale:bad:x":
+				return nil, true, errors.New("bad filter")
+			}
+			return nil, false, nil
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Expression(tt.expr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expression(%q) failed: %v", tt.expr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConfig_GetGroup(t *testing.T) {
+	cfg := &Config{
+		Groups: map[string][]string{"all": {"*"}, "dev": {"@all", "!pi"}},
+		Hosts:  map[string]Host{"pi": {Address: "10.0.0.2"}, "nas": {}},
+	}
+
+	got, err := cfg.GetGroup("dev")
+	if err != nil {
+		t.Fatalf("GetGroup failed: %v", err)
+	}
+	if want := []string{"nas"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the name of a repository's own config file
+const ProjectFile = ".dw.yaml"
+
+// DefaultGroup is targeted when neither --group nor any config names a group
+const DefaultGroup = "dev"
+
+// Project holds settings for working in a repository. config.yaml sets
+// them for every directory, and a .dw.yaml in the repository overrides
+// them there.
+type Project struct {
+	// Group is the default for --group
+	Group string `yaml:"group,omitempty" json:"group,omitempty"`
+	Sync  Sync   `yaml:"sync,omitempty" json:"sync,omitzero"`
+	// Setup commands run in order on the host before the command of dw
+	// run, dw submit or a task, before each dw map item and before the
+	// tests of dw test, from the same directory
+	Setup []string `yaml:"setup,omitempty" json:"setup,omitempty"`
+	// Tasks are recipes run by dw task, by name
+	Tasks map[string]Task `yaml:"tasks,omitempty" json:"tasks,omitempty"`
+}
+
+// Sync configures how directories are mirrored on hosts
+type Sync struct {
+	// Exclude lists rsync patterns skipped on top of the built-in ones
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	// RemotePath is where the repository is mirrored on hosts, instead of
+	// the same path under the remote home. Only .dw.yaml can set it.
+	RemotePath string `yaml:"remote_path,omitempty" json:"remote_path,omitempty"`
+}
+
+// FindProject returns the .dw.yaml in dir or the nearest directory above
+// it, or "" if there is none
+func FindProject(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadProject reads a .dw.yaml
+func LoadProject(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Project
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid project config %s: %w", path, err)
+	}
+	if err := validateTasks(p.Tasks); err != nil {
+		return nil, fmt.Errorf("invalid project config %s: %w", path, err)
+	}
+
+	// Task sync paths mean the same thing from any directory in the
+	// repository
+	for name, t := range p.Tasks {
+		if t.Sync != "" && !filepath.IsAbs(expandHome(t.Sync)) {
+			t.Sync = filepath.Join(filepath.Dir(path), t.Sync)
+			p.Tasks[name] = t
+		}
+	}
+	return &p, nil
+}
+
+// Setting is one project setting in effect and the file it came from,
+// or "default"
+type Setting struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+}
+
+// Effective is the configuration in effect in a directory: config.yaml
+// with the nearest .dw.yaml applied
+type Effective struct {
+	*Config
+	// ProjectPath is the .dw.yaml applied, or empty if there is none
+	ProjectPath string
+	// Settings lists every project setting in effect, with list settings
+	// such as sync.exclude given one entry per item
+	Settings []Setting
+}
+
+// LoadEffective reads config.yaml and applies the .dw.yaml found from dir
+func LoadEffective(dir string) (*Effective, error) {
+	cfg, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	cfgPath, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	projectPath, err := FindProject(dir)
+	if err != nil {
+		return nil, err
+	}
+	var project *Project
+	if projectPath != "" {
+		if project, err = LoadProject(projectPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return Merge(cfg, cfgPath, project, projectPath), nil
+}
+
+// Merge applies project, read from projectPath, over cfg, read from
+// cfgPath. project may be nil. A setting .dw.yaml gives replaces the one in
+// config.yaml, except that sync excludes from both apply and tasks are
+// replaced one by one.
+func Merge(cfg *Config, cfgPath string, project *Project, projectPath string) *Effective {
+	if project == nil {
+		project = &Project{}
+	}
+
+	merged := *cfg
+	e := &Effective{Config: &merged, ProjectPath: projectPath}
+	add := func(key, value, source string) {
+		e.Settings = append(e.Settings, Setting{Key: key, Value: value, Source: source})
+	}
+
+	switch {
+	case project.Group != "":
+		merged.Group = project.Group
+		add("group", project.Group, projectPath)
+	case cfg.Group != "":
+		add("group", cfg.Group, cfgPath)
+	default:
+		merged.Group = DefaultGroup
+		add("group", DefaultGroup, "default")
+	}
+
+	merged.Sync.Exclude = append(slices.Clip(cfg.Sync.Exclude), project.Sync.Exclude...)
+	for _, pattern := range cfg.Sync.Exclude {
+		add("sync.exclude", pattern, cfgPath)
+	}
+	for _, pattern := range project.Sync.Exclude {
+		add("sync.exclude", pattern, projectPath)
+	}
+
+	merged.Sync.RemotePath = project.Sync.RemotePath
+	if project.Sync.RemotePath != "" {
+		add("sync.remote_path", project.Sync.RemotePath, projectPath)
+	}
+
+	setup, source := cfg.Setup, cfgPath
+	if len(project.Setup) > 0 {
+		setup, source = project.Setup, projectPath
+	}
+	merged.Setup = setup
+	for _, command := range setup {
+		add("setup", command, source)
+	}
+
+	merged.Tasks = make(map[string]Task, len(cfg.Tasks)+len(project.Tasks))
+	maps.Copy(merged.Tasks, cfg.Tasks)
+	maps.Copy(merged.Tasks, project.Tasks)
+	for _, name := range slices.Sorted(maps.Keys(merged.Tasks)) {
+		source := cfgPath
+		if _, ok := project.Tasks[name]; ok {
+			source = projectPath
+		}
+		add("tasks."+name, taskSummary(merged.Tasks[name]), source)
+	}
+
+	return e
+}
+
+// taskSummary describes a task in one line for Settings
+func taskSummary(t Task) string {
+	var parts []string
+	if t.Command != "" {
+		parts = append(parts, t.Command)
+	}
+	if t.Sync != "" {
+		parts = append(parts, "sync "+t.Sync)
+	}
+	if len(t.Deps) > 0 {
+		parts = append(parts, "after "+strings.Join(t.Deps, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Root returns the directory holding the .dw.yaml, or "" if there is none
+func (e *Effective) Root() string {
+	if e.ProjectPath == "" {
+		return ""
+	}
+	return filepath.Dir(e.ProjectPath)
+}
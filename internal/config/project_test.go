@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindProject(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	deep := filepath.Join(repo, "cmd", "app")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ProjectFile), []byte("group: build\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{repo, deep} {
+		got, err := FindProject(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(repo, ProjectFile); got != want {
+			t.Errorf("FindProject(%s) = %q, want %q", dir, got, want)
+		}
+	}
+
+	if got, err := FindProject(root); err != nil || got != "" {
+		t.Errorf("Expected no project above %s, got %q, %v", root, got, err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	cfg := &Config{
+		Groups: map[string][]string{"dev": {"homelab"}},
+		Project: Project{
+			Group: "dev",
+			Sync:  Sync{Exclude: []string{"*.log"}},
+			Setup: []string{"direnv allow"},
+		},
+	}
+	project := &Project{
+		Group: "build",
+		Sync:  Sync{Exclude: []string{"tmp/"}, RemotePath: "~/src/app"},
+		Setup: []string{"npm ci", "make deps"},
+	}
+
+	e := Merge(cfg, "config.yaml", project, "/repo/.dw.yaml")
+
+	if e.Group != "build" || e.Sync.RemotePath != "~/src/app" {
+		t.Errorf("Expected .dw.yaml to override group and remote path, got %+v", e.Project)
+	}
+	if want := []string{"*.log", "tmp/"}; !reflect.DeepEqual(e.Sync.Exclude, want) {
+		t.Errorf("Expected excludes %v, got %v", want, e.Sync.Exclude)
+	}
+	if want := []string{"npm ci", "make deps"}; !reflect.DeepEqual(e.Setup, want) {
+		t.Errorf("Expected setup %v, got %v", want, e.Setup)
+	}
+	if e.Root() != "/repo" {
+		t.Errorf("Expected root /repo, got %q", e.Root())
+	}
+
+	wantSettings := []Setting{
+		{Key: "group", Value: "build", Source: "/repo/.dw.yaml"},
+		{Key: "sync.exclude", Value: "*.log", Source: "config.yaml"},
+		{Key: "sync.exclude", Value: "tmp/", Source: "/repo/.dw.yaml"},
+		{Key: "sync.remote_path", Value: "~/src/app", Source: "/repo/.dw.yaml"},
+		{Key: "setup", Value: "npm ci", Source: "/repo/.dw.yaml"},
+		{Key: "setup", Value: "make deps", Source: "/repo/.dw.yaml"},
+	}
+	if !reflect.DeepEqual(e.Settings, wantSettings) {
+		t.Errorf("Expected settings %+v, got %+v", wantSettings, e.Settings)
+	}
+
+	// The global config is left alone, so it can still be saved
+	if cfg.Group != "dev" || len(cfg.Sync.Exclude) != 1 {
+		t.Errorf("Expected config.yaml settings unchanged, got %+v", cfg.Project)
+	}
+}
+
+func TestMerge_Defaults(t *testing.T) {
+	e := Merge(&Config{Project: Project{Setup: []string{"true"}}}, "config.yaml", nil, "")
+
+	want := []Setting{
+		{Key: "group", Value: DefaultGroup, Source: "default"},
+		{Key: "setup", Value: "true", Source: "config.yaml"},
+	}
+	if !reflect.DeepEqual(e.Settings, want) {
+		t.Errorf("Expected settings %+v, got %+v", want, e.Settings)
+	}
+	if e.Group != DefaultGroup || e.Root() != "" {
+		t.Errorf("Expected default group and no root, got %q, %q", e.Group, e.Root())
+	}
+}
+
+func TestLoadEffective(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	path, err := ConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("groups:\n  dev: [homelab]\ngroup: dev\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := filepath.Join(home, "repo")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ProjectFile), []byte("group: build\nsetup: [npm ci]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := LoadEffective(repo)
+	if err != nil {
+		t.Fatalf("LoadEffective failed: %v", err)
+	}
+	if e.Group != "build" || e.ProjectPath != filepath.Join(repo, ProjectFile) {
+		t.Errorf("Expected the .dw.yaml group, got %q from %q", e.Group, e.ProjectPath)
+	}
+	if want := []string{"homelab"}; !reflect.DeepEqual(e.Groups["dev"], want) {
+		t.Errorf("Expected groups from config.yaml, got %v", e.Groups)
+	}
+
+	// remote_path only makes sense next to the directory it mirrors
+	if err := os.WriteFile(path, []byte("sync:\n  remote_path: ~/src\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEffective(repo); err == nil || !strings.Contains(err.Error(), "remote_path") {
+		t.Errorf("Expected remote_path in config.yaml to be rejected, got %v", err)
+	}
+}
@@ -2,17 +2,35 @@ package config
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strings"
 )
 
+// maxIncludeDepth matches the recursion limit used by OpenSSH
+const maxIncludeDepth = 16
+
 // SSHHost represents a host from SSH config
 type SSHHost struct {
-	Alias    string
-	Hostname string
-	User     string
-	Port     string
+	Alias         string
+	Hostname      string
+	User          string
+	Port          string
+	IdentityFiles []string
+	ProxyJump     string
+	ProxyCommand  string
+	// Options holds every other keyword (lowercased) with its first value
+	Options map[string]string
+}
+
+// directive is a single keyword line from an SSH config file.
+// Include directives carry the parsed contents of every matched file.
+type directive struct {
+	key      string
+	args     []string
+	included [][]directive
 }
 
 // ParseSSHConfig reads ~/.ssh/config and extracts host configurations
@@ -22,15 +40,46 @@ func ParseSSHConfig() ([]SSHHost, error) {
 		return nil, err
 	}
 
-	configPath := filepath.Join(home, ".ssh", "config")
-	file, err := os.Open(configPath)
+	return ParseSSHConfigFile(filepath.Join(home, ".ssh", "config"))
+}
+
+// ParseSSHConfigFile reads an SSH config file and resolves every concrete
+// host alias it declares. Values are applied the way `ssh -G` does: the
+// first value obtained for a keyword wins, so wildcard blocks further down
+// act as defaults. Include directives are followed, with relative paths
+// resolved against ~/.ssh.
+func ParseSSHConfigFile(path string) ([]SSHHost, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	directives, err := readSSHConfig(path, filepath.Join(home, ".ssh"), 0)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
 	var hosts []SSHHost
-	var currentHost *SSHHost
+	for _, alias := range hostAliases(directives, nil) {
+		hosts = append(hosts, resolveHost(directives, alias))
+	}
+
+	return hosts, nil
+}
+
+// readSSHConfig parses a config file into directives, expanding includes
+func readSSHConfig(path, sshDir string, depth int) ([]directive, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("%s: too many nested includes", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var directives []directive
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
@@ -41,46 +90,310 @@ func ParseSSHConfig() ([]SSHHost, error) {
 			continue
 		}
 
-		fields := strings.Fields(line)
-		if len(fields) < 2 {
+		key, args := splitDirective(line)
+		if key == "" || len(args) == 0 {
 			continue
 		}
 
-		key := strings.ToLower(fields[0])
-		value := fields[1]
+		d := directive{key: key, args: args}
+
+		if key == "include" {
+			for _, pattern := range args {
+				pattern = expandHome(pattern)
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(sshDir, pattern)
+				}
 
+				matches, err := filepath.Glob(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("%s: bad include %q: %w", path, pattern, err)
+				}
+
+				for _, match := range matches {
+					included, err := readSSHConfig(match, sshDir, depth+1)
+					if err != nil {
+						return nil, err
+					}
+					d.included = append(d.included, included)
+				}
+			}
+		}
+
+		directives = append(directives, d)
+	}
+
+	return directives, scanner.Err()
+}
+
+// splitDirective splits a config line into a lowercased keyword and its
+// arguments. Both "Key value" and "Key=value" forms are accepted, and
+// double-quoted arguments may contain spaces.
+func splitDirective(line string) (string, []string) {
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), nil
+	}
+
+	key := line[:i]
+	rest := strings.TrimLeft(line[i:], " \t")
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+
+	var args []string
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range rest {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+
+	return strings.ToLower(key), args
+}
+
+// hostAliases returns every concrete alias named on a Host line, in order
+// of first appearance. Wildcard and negated patterns are skipped.
+func hostAliases(directives []directive, seen map[string]bool) []string {
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+
+	var aliases []string
+	for _, d := range directives {
+		switch d.key {
+		case "host":
+			for _, pattern := range d.args {
+				if strings.ContainsAny(pattern, "*?!") || seen[pattern] {
+					continue
+				}
+				seen[pattern] = true
+				aliases = append(aliases, pattern)
+			}
+		case "include":
+			for _, included := range d.included {
+				aliases = append(aliases, hostAliases(included, seen)...)
+			}
+		}
+	}
+
+	return aliases
+}
+
+// resolveHost evaluates the whole config for one alias
+func resolveHost(directives []directive, alias string) SSHHost {
+	r := &resolver{
+		alias:   alias,
+		options: make(map[string]string),
+	}
+
+	active := true
+	r.eval(directives, &active, false)
+
+	h := SSHHost{
+		Alias:         alias,
+		Hostname:      r.options["hostname"],
+		User:          r.options["user"],
+		Port:          r.options["port"],
+		IdentityFiles: r.identityFiles,
+		ProxyJump:     r.options["proxyjump"],
+		ProxyCommand:  r.options["proxycommand"],
+		Options:       make(map[string]string),
+	}
+
+	for key, value := range r.options {
 		switch key {
+		case "hostname", "user", "port", "proxyjump", "proxycommand":
+		default:
+			h.Options[key] = value
+		}
+	}
+
+	if h.Hostname == "" {
+		h.Hostname = alias
+	}
+	h.Hostname = expandTokens(h.Hostname, alias)
+
+	if h.Port == "" {
+		h.Port = "22" // default
+	}
+
+	return h
+}
+
+// resolver accumulates options for a single alias
+type resolver struct {
+	alias         string
+	options       map[string]string
+	identityFiles []string
+}
+
+// eval applies directives to the options. With neverMatch set, as for a
+// file included from a block that doesn't apply, no Host or Match line
+// can make a block apply, as with OpenSSH's SSHCONF_NEVERMATCH.
+func (r *resolver) eval(directives []directive, active *bool, neverMatch bool) {
+	for _, d := range directives {
+		switch d.key {
 		case "host":
-			// Skip wildcard hosts
-			if strings.Contains(value, "*") {
-				currentHost = nil
-				continue
+			*active = !neverMatch && matchPatterns(d.args, r.alias)
+
+		case "match":
+			*active = !neverMatch && r.matchCriteria(d.args)
+
+		case "include":
+			// Included files inherit the enclosing block, and any Host or
+			// Match lines inside them do not leak back out
+			saved := *active
+			for _, included := range d.included {
+				r.eval(included, active, neverMatch || !saved)
 			}
+			*active = saved
+
+		case "identityfile":
+			if *active {
+				r.identityFiles = append(r.identityFiles, expandHome(d.args[0]))
+			}
+
+		default:
+			if _, set := r.options[d.key]; *active && !set {
+				r.options[d.key] = strings.Join(d.args, " ")
+			}
+		}
+	}
+}
+
+// matchCriteria evaluates the criteria of a Match line. The exec and
+// canonical criteria are never considered matched since dw does not run
+// commands or canonicalize hostnames while reading config.
+func (r *resolver) matchCriteria(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		criterion := strings.ToLower(args[i])
+		negate := strings.HasPrefix(criterion, "!")
+		criterion = strings.TrimPrefix(criterion, "!")
 
-			currentHost = &SSHHost{
-				Alias: value,
-				Port:  "22", // default
+		var matched bool
+		switch criterion {
+		case "all", "final":
+			matched = true
+		case "canonical":
+			matched = false
+		case "host", "originalhost", "user", "localuser", "exec":
+			if i+1 >= len(args) {
+				return false
 			}
-			hosts = append(hosts, *currentHost)
+			i++
+			patterns := strings.Split(args[i], ",")
 
-		case "hostname":
-			if currentHost != nil {
-				hosts[len(hosts)-1].Hostname = value
+			switch criterion {
+			case "host":
+				target := r.alias
+				if hostname, ok := r.options["hostname"]; ok {
+					target = expandTokens(hostname, r.alias)
+				}
+				matched = matchPatterns(patterns, target)
+			case "originalhost":
+				matched = matchPatterns(patterns, r.alias)
+			case "user":
+				target := r.options["user"]
+				if target == "" {
+					target = localUser()
+				}
+				matched = matchPatterns(patterns, target)
+			case "localuser":
+				matched = matchPatterns(patterns, localUser())
+			case "exec":
+				matched = false
 			}
+		default:
+			return false
+		}
 
-		case "user":
-			if currentHost != nil {
-				hosts[len(hosts)-1].User = value
+		if matched == negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchPatterns reports whether name matches a list of ssh patterns.
+// At least one positive pattern must match and no negated pattern may.
+func matchPatterns(patterns []string, name string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if wildcardMatch(strings.ToLower(negated), strings.ToLower(name)) {
+				return false
 			}
+			continue
+		}
+		if wildcardMatch(strings.ToLower(pattern), strings.ToLower(name)) {
+			matched = true
+		}
+	}
+	return matched
+}
 
-		case "port":
-			if currentHost != nil {
-				hosts[len(hosts)-1].Port = value
+// wildcardMatch matches name against a pattern supporting * and ?
+func wildcardMatch(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(name) == 0 {
+				return false
+			}
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
 			}
 		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// expandTokens substitutes the %h and %% tokens allowed in HostName
+func expandTokens(value, alias string) string {
+	value = strings.ReplaceAll(value, "%%", "\x00")
+	value = strings.ReplaceAll(value, "%h", alias)
+	return strings.ReplaceAll(value, "\x00", "%")
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
 	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
 
-	return hosts, scanner.Err()
+func localUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
 }
 
 // GetHost finds a host by alias
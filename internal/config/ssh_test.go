@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -226,3 +227,280 @@ func TestParseSSHConfig_CommentsOnly(t *testing.T) {
 		t.Errorf("Expected 0 hosts from comments-only config, got %d", len(hosts))
 	}
 }
+
+// writeSSHConfig creates ~/.ssh under a temporary HOME with the given files
+func writeSSHConfig(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(tmpDir, ".ssh", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("HOME", tmpDir)
+}
+
+func TestParseSSHConfig_Include(t *testing.T) {
+	writeSSHConfig(t, map[string]string{
+		"config": `Include config.d/*
+
+Host homelab
+    HostName 100.72.192.70
+`,
+		"config.d/work": `Host build-1 build-2
+    User ci
+`,
+		"config.d/lab": `Host pi
+    HostName 10.0.0.5
+`,
+	})
+
+	hosts, err := ParseSSHConfig()
+	if err != nil {
+		t.Fatalf("ParseSSHConfig failed: %v", err)
+	}
+
+	// Included files are read in lexical order before the rest of config
+	want := []string{"pi", "build-1", "build-2", "homelab"}
+	if len(hosts) != len(want) {
+		t.Fatalf("Expected %d hosts, got %d: %+v", len(want), len(hosts), hosts)
+	}
+	for i, alias := range want {
+		if hosts[i].Alias != alias {
+			t.Errorf("hosts[%d] = %s, want %s", i, hosts[i].Alias, alias)
+		}
+	}
+
+	if h := GetHost(hosts, "build-2"); h == nil || h.User != "ci" {
+		t.Errorf("Expected build-2 to inherit User ci from its multi-alias block, got %+v", h)
+	}
+}
+
+func TestParseSSHConfig_IncludeInsideHostBlock(t *testing.T) {
+	writeSSHConfig(t, map[string]string{
+		"config": `Host homelab
+    Include homelab.conf
+
+Host other
+    HostName other.example.com
+`,
+		"homelab.conf": `User wv3
+`,
+	})
+
+	hosts, err := ParseSSHConfig()
+	if err != nil {
+		t.Fatalf("ParseSSHConfig failed: %v", err)
+	}
+
+	if h := GetHost(hosts, "homelab"); h == nil || h.User != "wv3" {
+		t.Errorf("Expected homelab to pick up User from include, got %+v", h)
+	}
+	if h := GetHost(hosts, "other"); h == nil || h.User != "" {
+		t.Errorf("Expected include to stay scoped to homelab, got %+v", h)
+	}
+}
+
+func TestParseSSHConfig_IncludeInsideInactiveBlock(t *testing.T) {
+	writeSSHConfig(t, map[string]string{
+		"config": `Host homelab
+    HostName 100.72.192.70
+
+Host other
+    Include other.conf
+`,
+		"other.conf": `Port 2200
+
+Host *
+    User wv3
+
+Match all
+    ProxyJump bastion
+`,
+	})
+
+	hosts, err := ParseSSHConfig()
+	if err != nil {
+		t.Fatalf("ParseSSHConfig failed: %v", err)
+	}
+
+	h := GetHost(hosts, "homelab")
+	if h == nil {
+		t.Fatal("Expected homelab to be found")
+	}
+	if h.Port != "22" || h.User != "" || h.ProxyJump != "" {
+		t.Errorf("Expected no block of an include from another host's block to apply, got %+v", h)
+	}
+}
+
+func TestParseSSHConfig_WildcardDefaults(t *testing.T) {
+	writeSSHConfig(t, map[string]string{
+		"config": `Host homelab
+    HostName 100.72.192.70
+    User wv3
+
+Host build-*
+    HostName %h.internal
+    ProxyJump bastion
+
+Host build-fast
+    Port 2200
+
+Host * !homelab
+    User admin
+    Port 2222
+
+Host *
+    IdentityFile ~/.ssh/id_ed25519
+    User nobody
+    ServerAliveInterval 60
+`,
+	})
+
+	hosts, err := ParseSSHConfig()
+	if err != nil {
+		t.Fatalf("ParseSSHConfig failed: %v", err)
+	}
+
+	homelab := GetHost(hosts, "homelab")
+	if homelab == nil {
+		t.Fatal("homelab not found")
+	}
+	// First obtained value wins, so later wildcards don't override
+	if homelab.User != "wv3" || homelab.Port != "22" {
+		t.Errorf("homelab: expected user wv3 port 22, got %+v", homelab)
+	}
+	if homelab.Options["serveraliveinterval"] != "60" {
+		t.Errorf("homelab: expected ServerAliveInterval from Host *, got %v", homelab.Options)
+	}
+	home, _ := os.UserHomeDir()
+	if len(homelab.IdentityFiles) != 1 || homelab.IdentityFiles[0] != filepath.Join(home, ".ssh", "id_ed25519") {
+		t.Errorf("homelab: expected expanded IdentityFile, got %v", homelab.IdentityFiles)
+	}
+
+	fast := GetHost(hosts, "build-fast")
+	if fast == nil {
+		t.Fatal("build-fast not found")
+	}
+	if fast.Hostname != "build-fast.internal" {
+		t.Errorf("build-fast: expected %%h expansion, got %s", fast.Hostname)
+	}
+	if fast.ProxyJump != "bastion" {
+		t.Errorf("build-fast: expected ProxyJump bastion, got %q", fast.ProxyJump)
+	}
+	if fast.Port != "2200" || fast.User != "admin" {
+		t.Errorf("build-fast: expected port 2200 user admin, got %+v", fast)
+	}
+
+	// Wildcard-only patterns never become hosts themselves
+	for _, h := range hosts {
+		if strings.ContainsAny(h.Alias, "*!") {
+			t.Errorf("Unexpected wildcard host %s", h.Alias)
+		}
+	}
+}
+
+func TestParseSSHConfig_Match(t *testing.T) {
+	writeSSHConfig(t, map[string]string{
+		"config": `Host homelab
+    HostName 100.72.192.70
+
+Host laptop
+    HostName laptop.local
+
+Match host 100.72.*
+    User wv3
+
+Match originalhost laptop !host 100.*
+    Port 2022
+
+Match exec "test -f /nonexistent"
+    User never
+
+Match all
+    ForwardAgent yes
+`,
+	})
+
+	hosts, err := ParseSSHConfig()
+	if err != nil {
+		t.Fatalf("ParseSSHConfig failed: %v", err)
+	}
+
+	homelab := GetHost(hosts, "homelab")
+	if homelab.User != "wv3" {
+		t.Errorf("homelab: expected Match host to set user wv3, got %q", homelab.User)
+	}
+	if homelab.Port != "22" {
+		t.Errorf("homelab: expected default port, got %s", homelab.Port)
+	}
+
+	laptop := GetHost(hosts, "laptop")
+	if laptop.Port != "2022" {
+		t.Errorf("laptop: expected Match originalhost to set port 2022, got %s", laptop.Port)
+	}
+	if laptop.User == "never" {
+		t.Error("laptop: Match exec should not be evaluated")
+	}
+
+	for _, h := range hosts {
+		if h.Options["forwardagent"] != "yes" {
+			t.Errorf("%s: expected Match all to apply, got %v", h.Alias, h.Options)
+		}
+	}
+}
+
+func TestSplitDirective(t *testing.T) {
+	tests := []struct {
+		line     string
+		wantKey  string
+		wantArgs []string
+	}{
+		{"HostName example.com", "hostname", []string{"example.com"}},
+		{"Port=2222", "port", []string{"2222"}},
+		{"User = admin", "user", []string{"admin"}},
+		{"Host a b\tc", "host", []string{"a", "b", "c"}},
+		{`IdentityFile "~/My Keys/id_rsa"`, "identityfile", []string{"~/My Keys/id_rsa"}},
+		{"Include", "include", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			key, args := splitDirective(tt.line)
+			if key != tt.wantKey {
+				t.Errorf("key = %q, want %q", key, tt.wantKey)
+			}
+			if strings.Join(args, "|") != strings.Join(tt.wantArgs, "|") {
+				t.Errorf("args = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{[]string{"homelab"}, "homelab", true},
+		{[]string{"HomeLab"}, "homelab", true},
+		{[]string{"build-*"}, "build-1", true},
+		{[]string{"build-?"}, "build-10", false},
+		{[]string{"*", "!laptop"}, "laptop", false},
+		{[]string{"*", "!laptop"}, "server", true},
+		{[]string{"!laptop"}, "server", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPatterns(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("matchPatterns(%v, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
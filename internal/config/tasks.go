@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Task is a named recipe run by dw task. Group, Selector, Sync, Timeout
+// and Artifacts work like the dw run flags of the same name.
+type Task struct {
+	// Command runs through the remote shell. A task without one only
+	// syncs, or only runs its deps.
+	Command  string `yaml:"command,omitempty" json:"command,omitempty"`
+	Group    string `yaml:"group,omitempty" json:"group,omitempty"`
+	Selector string `yaml:"selector,omitempty" json:"selector,omitempty"`
+	// All runs the command on every host in the group instead of the best
+	All bool `yaml:"all,omitempty" json:"all,omitempty"`
+	// Sync is a directory pushed to the hosts first; the command runs from
+	// its remote mirror. Relative paths in .dw.yaml are relative to the
+	// directory holding it.
+	Sync      string            `yaml:"sync,omitempty" json:"sync,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Timeout   string            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Artifacts []string          `yaml:"artifacts,omitempty" json:"artifacts,omitempty"`
+	// Deps are tasks run first, in order
+	Deps []string `yaml:"deps,omitempty" json:"deps,omitempty"`
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidEnvName reports whether name can be exported by a POSIX shell
+func ValidEnvName(name string) bool {
+	return envName.MatchString(name)
+}
+
+// Validate checks that the task does something and that its timeout and
+// environment can be used
+func (t Task) Validate() error {
+	if t.Command == "" && t.Sync == "" && len(t.Deps) == 0 {
+		return fmt.Errorf("needs a command, sync or deps")
+	}
+	if _, err := t.TimeoutDuration(); err != nil {
+		return err
+	}
+	for name := range t.Env {
+		if !ValidEnvName(name) {
+			return fmt.Errorf("invalid env name %q", name)
+		}
+	}
+	return nil
+}
+
+// TimeoutDuration returns Timeout parsed; 0 means no limit
+func (t Task) TimeoutDuration() (time.Duration, error) {
+	if t.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(t.Timeout)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", t.Timeout)
+	}
+	return d, nil
+}
+
+// validateTasks checks every task in tasks
+func validateTasks(tasks map[string]Task) error {
+	for name, t := range tasks {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("task %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// TaskOrder returns the tasks to run for name: its deps, each before the
+// tasks that need it and only once, then name itself
+func TaskOrder(tasks map[string]Task, name string) ([]string, error) {
+	var order []string
+	var visit func(name string, stack []string) error
+	visit = func(name string, stack []string) error {
+		if slices.Contains(stack, name) {
+			return fmt.Errorf("task cycle: %s", strings.Join(append(stack, name), " -> "))
+		}
+		if slices.Contains(order, name) {
+			return nil
+		}
+		t, ok := tasks[name]
+		if !ok {
+			if len(stack) > 0 {
+				return fmt.Errorf("task %q needed by %s not found", name, stack[len(stack)-1])
+			}
+			return fmt.Errorf("task %q not found", name)
+		}
+		for _, dep := range t.Deps {
+			if err := visit(dep, append(stack, name)); err != nil {
+				return err
+			}
+		}
+		order = append(order, name)
+		return nil
+	}
+
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTaskOrder(t *testing.T) {
+	tasks := map[string]Task{
+		"sync":     {Sync: "."},
+		"generate": {Command: "go generate ./...", Deps: []string{"sync"}},
+		"build":    {Command: "go build ./...", Deps: []string{"sync", "generate"}},
+		"test":     {Command: "go test ./...", Deps: []string{"generate", "build"}},
+		"loop":     {Command: "true", Deps: []string{"again"}},
+		"again":    {Command: "true", Deps: []string{"loop"}},
+		"broken":   {Command: "true", Deps: []string{"missing"}},
+	}
+
+	tests := []struct {
+		name    string
+		task    string
+		want    []string
+		wantErr string
+	}{
+		{name: "no deps", task: "sync", want: []string{"sync"}},
+		{name: "deps in order", task: "build", want: []string{"sync", "generate", "build"}},
+		{name: "shared deps run once", task: "test", want: []string{"sync", "generate", "build", "test"}},
+		{name: "cycle", task: "loop", wantErr: "task cycle: loop -> again -> loop"},
+		{name: "missing dep", task: "broken", wantErr: `task "missing" needed by broken not found`},
+		{name: "missing task", task: "deploy", wantErr: `task "deploy" not found`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TaskOrder(tasks, tt.task)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TaskOrder(%q) failed: %v", tt.task, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTask_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		task    Task
+		wantErr string
+	}{
+		{name: "command", task: Task{Command: "make", Timeout: "10m", Env: map[string]string{"GOFLAGS": "-race"}}},
+		{name: "sync only", task: Task{Sync: "."}},
+		{name: "deps only", task: Task{Deps: []string{"build"}}},
+		{name: "empty", task: Task{}, wantErr: "needs a command"},
+		{name: "bad timeout", task: Task{Command: "make", Timeout: "soon"}, wantErr: "invalid timeout"},
+		{name: "bad env", task: Task{Command: "make", Env: map[string]string{"MY-VAR": "x"}}, wantErr: "invalid env name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.task.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadProject_Tasks(t *testing.T) {
+	repo := t.TempDir()
+	path := filepath.Join(repo, ProjectFile)
+	data := `tasks:
+  sync:
+    sync: web
+  build:
+    command: go build ./...
+    sync: /srv/app
+    deps: [sync]
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadProject(path)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	if got, want := p.Tasks["sync"].Sync, filepath.Join(repo, "web"); got != want {
+		t.Errorf("Expected relative sync path resolved to %s, got %s", want, got)
+	}
+	if got := p.Tasks["build"].Sync; got != "/srv/app" {
+		t.Errorf("Expected absolute sync path kept, got %s", got)
+	}
+
+	// Project tasks replace global ones of the same name
+	cfg := &Config{Project: Project{Tasks: map[string]Task{
+		"build": {Command: "make"},
+		"lint":  {Command: "golangci-lint run"},
+	}}}
+	e := Merge(cfg, "config.yaml", p, path)
+	if e.Tasks["build"].Command != "go build ./..." || e.Tasks["lint"].Command != "golangci-lint run" {
+		t.Errorf("Expected tasks merged by name, got %+v", e.Tasks)
+	}
+	if cfg.Tasks["build"].Command != "make" {
+		t.Error("Expected config.yaml tasks unchanged")
+	}
+
+	if err := os.WriteFile(path, []byte("tasks:\n  nothing: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProject(path); err == nil || !strings.Contains(err.Error(), "task nothing") {
+		t.Errorf("Expected invalid task to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlIndent matches the indentation used in the README examples
+const yamlIndent = 2
+
+// encode renders cfg as YAML. When existing holds the current file, its
+// comments and key order are kept for everything cfg still contains.
+func encode(cfg *Config, existing []byte) ([]byte, error) {
+	var updated yaml.Node
+	if err := updated.Encode(cfg); err != nil {
+		return nil, err
+	}
+
+	root := &updated
+	var doc yaml.Node
+	if len(bytes.TrimSpace(existing)) > 0 {
+		if err := yaml.Unmarshal(existing, &doc); err == nil &&
+			doc.Kind == yaml.DocumentNode && len(doc.Content) == 1 && doc.Content[0].Kind == yaml.MappingNode {
+			renameGroups(doc.Content[0], cfg.renamed)
+			mergeNode(doc.Content[0], &updated)
+			root = &doc
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(yamlIndent)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeNode makes dst hold the values of src while keeping dst's comments
+// and ordering: mapping keys keep their position, keys src lacks are
+// dropped and new ones are appended, and sequence items that are still
+// present keep their comments.
+func mergeNode(dst, src *yaml.Node) {
+	if dst.Kind != src.Kind {
+		head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+		*dst = *src
+		dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+		return
+	}
+
+	switch dst.Kind {
+	case yaml.MappingNode:
+		var content []*yaml.Node
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			key, value := dst.Content[i], dst.Content[i+1]
+			if srcValue := mappingValue(src, key.Value); srcValue != nil {
+				mergeNode(value, srcValue)
+				content = append(content, key, value)
+			}
+		}
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			if mappingValue(dst, src.Content[i].Value) == nil {
+				content = append(content, src.Content[i], src.Content[i+1])
+			}
+		}
+		dst.Content = content
+
+	case yaml.SequenceNode:
+		used := make([]bool, len(dst.Content))
+		content := make([]*yaml.Node, 0, len(src.Content))
+		for _, item := range src.Content {
+			match := item
+			for i, old := range dst.Content {
+				if !used[i] && old.Kind == yaml.ScalarNode && item.Kind == yaml.ScalarNode && old.Value == item.Value {
+					used[i] = true
+					match = old
+					break
+				}
+			}
+			content = append(content, match)
+		}
+		// An empty list is written as [], which shouldn't force flow
+		// style on the items added to it
+		if len(dst.Content) == 0 {
+			dst.Style = src.Style
+		}
+		dst.Content = content
+
+	case yaml.ScalarNode:
+		// An unchanged value keeps the quoting it was written with
+		if dst.Value != src.Value {
+			dst.Value, dst.Tag, dst.Style = src.Value, src.Tag, src.Style
+		}
+
+	default:
+		dst.Content = src.Content
+	}
+}
+
+// renameGroups applies renames to the groups: in the config file root,
+// both keys and @references, so they keep their place and comments
+func renameGroups(root *yaml.Node, renamed map[string]string) {
+	groups := mappingValue(root, "groups")
+	if len(renamed) == 0 || groups == nil || groups.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(groups.Content); i += 2 {
+		if to, ok := renamed[groups.Content[i].Value]; ok {
+			groups.Content[i].Value = to
+		}
+		for _, item := range groups.Content[i+1].Content {
+			negate, ref := "", item.Value
+			if rest, ok := strings.CutPrefix(ref, "!"); ok {
+				negate, ref = "!", rest
+			}
+			if name, ok := strings.CutPrefix(ref, "@"); ok && item.Kind == yaml.ScalarNode {
+				if to, ok := renamed[name]; ok {
+					item.Value = negate + "@" + to
+				}
+			}
+		}
+	}
+}
+
+// mappingValue returns the value for key in a mapping node
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
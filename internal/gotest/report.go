@@ -0,0 +1,215 @@
+package gotest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Package statuses. A package with no status never reported a result,
+// usually because its shard's host failed.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Event is one line of go test -json output, as described by
+// go doc cmd/test2json
+type Event struct {
+	Time       time.Time `json:",omitzero"`
+	Action     string
+	Package    string  `json:",omitempty"`
+	ImportPath string  `json:",omitempty"`
+	Test       string  `json:",omitempty"`
+	Elapsed    float64 `json:",omitempty"`
+	Output     string  `json:",omitempty"`
+}
+
+// PackageResult is the outcome of testing one package
+type PackageResult struct {
+	Package     string   `json:"package" yaml:"package"`
+	Host        string   `json:"host" yaml:"host"`
+	Status      string   `json:"status" yaml:"status"`
+	Elapsed     float64  `json:"elapsed" yaml:"elapsed"`
+	FailedTests []string `json:"failed_tests,omitempty" yaml:"failed_tests,omitempty"`
+	// Output is what go test would print for the package when it fails:
+	// the output of failed tests followed by the package's own output
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// Passed reports whether the package passed or had no tests to run
+func (p *PackageResult) Passed() bool {
+	return p.Status == StatusPass || p.Status == StatusSkip
+}
+
+// Report merges the go test -json output of every shard
+type Report struct {
+	Packages []*PackageResult
+
+	byName  map[string]*PackageResult
+	tests   map[[2]string]*strings.Builder
+	pkgOut  map[string]*strings.Builder
+	hostOut map[string]*strings.Builder
+	lines   []streamLine
+}
+
+// streamLine is one event of the combined stream, kept as received so
+// fields dw does not know about survive the merge
+type streamLine struct {
+	time time.Time
+	raw  []byte
+}
+
+// NewReport returns an empty report expecting results for every package
+// in shards
+func NewReport(shards []Shard) *Report {
+	r := &Report{
+		byName:  make(map[string]*PackageResult),
+		tests:   make(map[[2]string]*strings.Builder),
+		pkgOut:  make(map[string]*strings.Builder),
+		hostOut: make(map[string]*strings.Builder),
+	}
+	for _, shard := range shards {
+		for _, pkg := range shard.Packages {
+			p := &PackageResult{Package: pkg, Host: shard.Host}
+			r.Packages = append(r.Packages, p)
+			r.byName[pkg] = p
+		}
+	}
+	slices.SortFunc(r.Packages, func(a, b *PackageResult) int {
+		return strings.Compare(a.Package, b.Package)
+	})
+	return r
+}
+
+// Add merges the go test -json output of the shard run on host. Lines
+// that are not JSON events, such as errors from the remote shell, are
+// kept as host output.
+func (r *Report) Add(host string, stdout []byte) {
+	var last time.Time
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		raw := slices.Clone(scanner.Bytes())
+
+		var ev Event
+		if err := json.Unmarshal(raw, &ev); err != nil || ev.Action == "" {
+			r.AddOutput(host, string(raw)+"\n")
+			ev = Event{Time: last, Action: "output", Output: string(raw) + "\n"}
+			raw, _ = json.Marshal(ev)
+		}
+		if ev.Time.IsZero() {
+			ev.Time = last
+		}
+		last = ev.Time
+
+		r.lines = append(r.lines, streamLine{time: ev.Time, raw: raw})
+		r.apply(host, ev)
+	}
+}
+
+// AddOutput records output from host that is not part of any package,
+// such as the remote command's stderr
+func (r *Report) AddOutput(host, output string) {
+	if output == "" {
+		return
+	}
+	builder(r.hostOut, host).WriteString(output)
+}
+
+// HostOutput returns the output recorded from host outside any package
+func (r *Report) HostOutput(host string) string {
+	if b := r.hostOut[host]; b != nil {
+		return b.String()
+	}
+	return ""
+}
+
+// apply updates package results from one event
+func (r *Report) apply(host string, ev Event) {
+	pkg := ev.Package
+	if ev.Action == "build-output" {
+		// ImportPath is e.g. "example.com/pkg [example.com/pkg.test]"
+		pkg, _, _ = strings.Cut(ev.ImportPath, " ")
+	}
+	if pkg == "" {
+		return
+	}
+
+	p := r.byName[pkg]
+	if p == nil {
+		p = &PackageResult{Package: pkg, Host: host}
+		r.byName[pkg] = p
+		i, _ := slices.BinarySearchFunc(r.Packages, pkg, func(p *PackageResult, name string) int {
+			return strings.Compare(p.Package, name)
+		})
+		r.Packages = slices.Insert(r.Packages, i, p)
+	}
+
+	switch ev.Action {
+	case "output", "build-output":
+		if ev.Test == "" {
+			builder(r.pkgOut, pkg).WriteString(ev.Output)
+		} else {
+			builder(r.tests, [2]string{pkg, ev.Test}).WriteString(ev.Output)
+		}
+	case StatusPass, StatusFail, StatusSkip:
+		if ev.Test != "" {
+			if ev.Action == StatusFail {
+				p.FailedTests = append(p.FailedTests, ev.Test)
+				p.Output += builder(r.tests, [2]string{pkg, ev.Test}).String()
+			}
+			delete(r.tests, [2]string{pkg, ev.Test})
+			return
+		}
+		p.Status = ev.Action
+		p.Elapsed = ev.Elapsed
+		if ev.Action == StatusFail {
+			p.Output += builder(r.pkgOut, pkg).String()
+		}
+	}
+}
+
+// builder returns the builder for key, creating it if needed
+func builder[K comparable](m map[K]*strings.Builder, key K) *strings.Builder {
+	if m[key] == nil {
+		m[key] = &strings.Builder{}
+	}
+	return m[key]
+}
+
+// Passed reports whether every package passed
+func (r *Report) Passed() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the packages that failed or never reported a result
+func (r *Report) Failed() []*PackageResult {
+	var failed []*PackageResult
+	for _, p := range r.Packages {
+		if !p.Passed() {
+			failed = append(failed, p)
+		}
+	}
+	return failed
+}
+
+// WriteJSON writes the combined go test -json stream of every shard,
+// ordered by event time
+func (r *Report) WriteJSON(w io.Writer) error {
+	lines := slices.Clone(r.lines)
+	slices.SortStableFunc(lines, func(a, b streamLine) int {
+		return a.time.Compare(b.time)
+	})
+	for _, line := range lines {
+		if _, err := w.Write(append(line.raw, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package gotest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const passStream = `{"Time":"2025-01-01T00:00:01Z","Action":"start","Package":"example.com/a"}
+{"Time":"2025-01-01T00:00:01Z","Action":"run","Package":"example.com/a","Test":"TestA"}
+{"Time":"2025-01-01T00:00:01Z","Action":"output","Package":"example.com/a","Test":"TestA","Output":"=== RUN   TestA\n"}
+{"Time":"2025-01-01T00:00:02Z","Action":"pass","Package":"example.com/a","Test":"TestA","Elapsed":0.5}
+{"Time":"2025-01-01T00:00:03Z","Action":"output","Package":"example.com/a","Output":"ok  \texample.com/a\t0.6s\n"}
+{"Time":"2025-01-01T00:00:03Z","Action":"pass","Package":"example.com/a","Elapsed":0.6}
+`
+
+const failStream = `{"Time":"2025-01-01T00:00:02Z","Action":"run","Package":"example.com/b","Test":"TestB"}
+{"Time":"2025-01-01T00:00:02Z","Action":"output","Package":"example.com/b","Test":"TestB","Output":"    b_test.go:9: boom\n"}
+{"Time":"2025-01-01T00:00:02Z","Action":"fail","Package":"example.com/b","Test":"TestB","Elapsed":0.1}
+{"Time":"2025-01-01T00:00:02Z","Action":"run","Package":"example.com/b","Test":"TestOK"}
+{"Time":"2025-01-01T00:00:02Z","Action":"output","Package":"example.com/b","Test":"TestOK","Output":"=== RUN   TestOK\n"}
+{"Time":"2025-01-01T00:00:02Z","Action":"pass","Package":"example.com/b","Test":"TestOK"}
+{"Time":"2025-01-01T00:00:04Z","Action":"output","Package":"example.com/b","Output":"FAIL\texample.com/b\t0.2s\n"}
+{"Time":"2025-01-01T00:00:04Z","Action":"fail","Package":"example.com/b","Elapsed":0.2}
+`
+
+func TestReport(t *testing.T) {
+	shards := []Shard{
+		{Host: "h1", Packages: []string{"example.com/a"}},
+		{Host: "h2", Packages: []string{"example.com/b", "example.com/c"}},
+	}
+
+	r := NewReport(shards)
+	r.Add("h1", []byte(passStream))
+	r.Add("h2", []byte(failStream+"bash: line 1: oops\n"))
+
+	var names, statuses []string
+	for _, p := range r.Packages {
+		names = append(names, p.Package)
+		statuses = append(statuses, p.Status)
+	}
+	if want := []string{"example.com/a", "example.com/b", "example.com/c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("packages = %v, want %v", names, want)
+	}
+	if want := []string{StatusPass, StatusFail, ""}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+
+	if r.Passed() {
+		t.Error("Passed() = true with a failing package")
+	}
+	if got := len(r.Failed()); got != 2 {
+		t.Errorf("Failed() has %d packages, want 2 (a failure and a missing result)", got)
+	}
+
+	b := r.Packages[1]
+	if !reflect.DeepEqual(b.FailedTests, []string{"TestB"}) {
+		t.Errorf("FailedTests = %v, want [TestB]", b.FailedTests)
+	}
+	if want := "    b_test.go:9: boom\nFAIL\texample.com/b\t0.2s\n"; b.Output != want {
+		t.Errorf("Output = %q, want %q", b.Output, want)
+	}
+	if b.Host != "h2" || b.Elapsed != 0.2 {
+		t.Errorf("host, elapsed = %s, %v, want h2, 0.2", b.Host, b.Elapsed)
+	}
+	if r.Packages[0].Output != "" {
+		t.Errorf("passing package kept output %q", r.Packages[0].Output)
+	}
+
+	if got := r.HostOutput("h2"); got != "bash: line 1: oops\n" {
+		t.Errorf("HostOutput() = %q", got)
+	}
+}
+
+func TestReport_BuildFailure(t *testing.T) {
+	stream := `{"ImportPath":"example.com/c [example.com/c.test]","Action":"build-output","Output":"c.go:3:1: syntax error\n"}
+{"ImportPath":"example.com/c [example.com/c.test]","Action":"build-fail"}
+{"Time":"2025-01-01T00:00:01Z","Action":"output","Package":"example.com/c","Output":"FAIL\texample.com/c [build failed]\n"}
+{"Time":"2025-01-01T00:00:01Z","Action":"fail","Package":"example.com/c","Elapsed":0,"FailedBuild":"example.com/c [example.com/c.test]"}
+`
+	r := NewReport([]Shard{{Host: "h1", Packages: []string{"example.com/c"}}})
+	r.Add("h1", []byte(stream))
+
+	c := r.Packages[0]
+	if c.Status != StatusFail {
+		t.Fatalf("Status = %q, want fail", c.Status)
+	}
+	if !strings.Contains(c.Output, "syntax error") {
+		t.Errorf("Output = %q, want the build error", c.Output)
+	}
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	r := NewReport(nil)
+	r.Add("h2", []byte(failStream))
+	r.Add("h1", []byte(passStream))
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if want := strings.Count(passStream+failStream, "\n"); len(lines) != want {
+		t.Fatalf("got %d lines, want %d", len(lines), want)
+	}
+	// Events are merged by time, keeping unknown fields intact
+	if !strings.Contains(lines[0], `"Action":"start"`) {
+		t.Errorf("first line = %s, want the earliest event", lines[0])
+	}
+	if !strings.Contains(lines[len(lines)-1], `"Package":"example.com/b"`) {
+		t.Errorf("last line = %s, want the latest event", lines[len(lines)-1])
+	}
+	if len(r.Packages) != 2 {
+		t.Errorf("packages not listed in shards are still reported, got %d", len(r.Packages))
+	}
+}
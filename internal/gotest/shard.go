@@ -0,0 +1,96 @@
+// Package gotest splits go test runs across hosts and merges their results
+package gotest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/WillyV3/distributed/internal/host"
+	"github.com/WillyV3/distributed/internal/remote"
+)
+
+// minFree is the share of a host's CPUs still counted when its score
+// says it is fully busy, so no reachable host is left out entirely
+const minFree = 0.1
+
+// Shard is the set of packages tested on one host
+type Shard struct {
+	Host     string   `json:"host" yaml:"host"`
+	Packages []string `json:"packages" yaml:"packages"`
+}
+
+// List returns the import paths of the packages matching patterns, as
+// listed by go list run from dir
+func List(ctx context.Context, dir string, patterns []string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "go", append([]string{"list"}, patterns...)...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("go list: %s", msg)
+		}
+		return nil, fmt.Errorf("go list: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// Weight returns how much of a test run a host should take: its CPU
+// count scaled by how idle its score says it is. Scores are read as a
+// percentage of busyness, so a host scoring 25 counts 75% of its CPUs.
+func Weight(info *host.LoadInfo) float64 {
+	cpus := float64(max(info.CPUs, 1))
+	free := 1 - info.Score/100
+	return cpus * min(max(free, minFree), 1)
+}
+
+// Partition spreads packages across hosts in proportion to their Weight.
+// Packages keep their listed order within each shard, and hosts that get
+// no packages are left out. Shards are returned in hosts order.
+func Partition(packages []string, hosts []*host.LoadInfo) []Shard {
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	weights := make([]float64, len(hosts))
+	for i, info := range hosts {
+		weights[i] = Weight(info)
+	}
+
+	assigned := make([][]string, len(hosts))
+	for _, pkg := range packages {
+		// Give each package to the host that would be least loaded,
+		// relative to its weight, after taking it
+		best := 0
+		for i := range hosts {
+			if float64(len(assigned[i])+1)/weights[i] < float64(len(assigned[best])+1)/weights[best] {
+				best = i
+			}
+		}
+		assigned[best] = append(assigned[best], pkg)
+	}
+
+	var shards []Shard
+	for i, info := range hosts {
+		if len(assigned[i]) > 0 {
+			shards = append(shards, Shard{Host: info.Host, Packages: assigned[i]})
+		}
+	}
+	return shards
+}
+
+// Command returns the remote command line that tests the shard's
+// packages, passing flags through to go test
+func (s Shard) Command(flags []string) string {
+	args := slices.Concat([]string{"go", "test", "-json"}, flags, s.Packages)
+	for i, arg := range args {
+		args[i] = remote.Quote(arg)
+	}
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,129 @@
+package gotest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/WillyV3/distributed/internal/host"
+)
+
+func TestWeight(t *testing.T) {
+	tests := []struct {
+		name string
+		info host.LoadInfo
+		want float64
+	}{
+		{"idle", host.LoadInfo{CPUs: 8, Score: 0}, 8},
+		{"quarter busy", host.LoadInfo{CPUs: 8, Score: 25}, 6},
+		{"fully busy keeps a share", host.LoadInfo{CPUs: 8, Score: 150}, 0.8},
+		{"negative score is idle", host.LoadInfo{CPUs: 4, Score: -20}, 4},
+		{"unknown cpus counts one", host.LoadInfo{CPUs: 0, Score: 50}, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Weight(&tt.info); got != tt.want {
+				t.Errorf("Weight() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartition(t *testing.T) {
+	pkgs := []string{"a", "b", "c", "d", "e", "f"}
+
+	tests := []struct {
+		name  string
+		hosts []*host.LoadInfo
+		want  []Shard
+	}{
+		{
+			name:  "no hosts",
+			hosts: nil,
+			want:  nil,
+		},
+		{
+			name:  "one host takes everything",
+			hosts: []*host.LoadInfo{{Host: "h1", CPUs: 4}},
+			want:  []Shard{{Host: "h1", Packages: pkgs}},
+		},
+		{
+			name: "equal hosts split evenly",
+			hosts: []*host.LoadInfo{
+				{Host: "h1", CPUs: 4},
+				{Host: "h2", CPUs: 4},
+			},
+			want: []Shard{
+				{Host: "h1", Packages: []string{"a", "c", "e"}},
+				{Host: "h2", Packages: []string{"b", "d", "f"}},
+			},
+		},
+		{
+			name: "more cpus take more",
+			hosts: []*host.LoadInfo{
+				{Host: "big", CPUs: 8},
+				{Host: "small", CPUs: 4},
+			},
+			want: []Shard{
+				{Host: "big", Packages: []string{"a", "b", "d", "e"}},
+				{Host: "small", Packages: []string{"c", "f"}},
+			},
+		},
+		{
+			name: "busy host takes less",
+			hosts: []*host.LoadInfo{
+				{Host: "busy", CPUs: 8, Score: 75},
+				{Host: "idle", CPUs: 4},
+			},
+			want: []Shard{
+				{Host: "busy", Packages: []string{"b", "e"}},
+				{Host: "idle", Packages: []string{"a", "c", "d", "f"}},
+			},
+		},
+		{
+			name: "hosts without packages are left out",
+			hosts: []*host.LoadInfo{
+				{Host: "h1", CPUs: 64},
+				{Host: "h2", CPUs: 1},
+			},
+			want: []Shard{
+				{Host: "h1", Packages: pkgs},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Partition(pkgs, tt.hosts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Partition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShardCommand(t *testing.T) {
+	shard := Shard{Host: "h1", Packages: []string{"example.com/a", "example.com/b"}}
+
+	got := shard.Command([]string{"-run", "Test Foo"})
+	want := `'go' 'test' '-json' '-run' 'Test Foo' 'example.com/a' 'example.com/b'`
+	if got != want {
+		t.Errorf("Command() = %q, want %q", got, want)
+	}
+}
+
+func TestList(t *testing.T) {
+	pkgs, err := List(context.Background(), ".", []string{"."})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := []string{"github.com/WillyV3/distributed/internal/gotest"}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("List() = %v, want %v", pkgs, want)
+	}
+
+	if _, err := List(context.Background(), ".", []string{"./does-not-exist"}); err == nil {
+		t.Error("List() of a missing package should fail")
+	}
+}
@@ -0,0 +1,209 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tools whose versions are collected as facts
+var Tools = []string{"go", "node", "docker", "rsync"}
+
+// Facts describe a host's platform and installed toolchains. Unlike load
+// they rarely change, so they are cached between runs.
+type Facts struct {
+	Host        string            `json:"host" yaml:"host"`
+	OS          string            `json:"os" yaml:"os"`
+	Kernel      string            `json:"kernel" yaml:"kernel"`
+	Arch        string            `json:"arch" yaml:"arch"`
+	CPUModel    string            `json:"cpu_model" yaml:"cpu_model"`
+	CPUs        int               `json:"cpus" yaml:"cpus"`
+	MemTotalMB  int               `json:"mem_total_mb" yaml:"mem_total_mb"`
+	DiskFreeMB  int               `json:"disk_free_mb" yaml:"disk_free_mb"`
+	Tools       map[string]string `json:"tools,omitempty" yaml:"tools,omitempty"`
+	CollectedAt time.Time         `json:"collected_at" yaml:"collected_at"`
+}
+
+// factsScript collects facts as key=value lines. Toolchains are often
+// installed outside the PATH of non-interactive ssh sessions, so common
+// install locations are searched too.
+var factsScript = `
+PATH="$PATH:/usr/local/go/bin:$HOME/go/bin:$HOME/.local/bin:/opt/homebrew/bin:/usr/local/bin"
+echo "os=$(uname -s)"
+echo "kernel=$(uname -r)"
+echo "arch=$(uname -m)"
+if [ "$(uname -s)" = Darwin ]; then
+    echo "cpu_model=$(sysctl -n machdep.cpu.brand_string)"
+    echo "cpus=$(sysctl -n hw.ncpu)"
+    echo "mem_total_kb=$(($(sysctl -n hw.memsize) / 1024))"
+else
+    echo "cpu_model=$(awk -F': ' '/^model name/ {print $2; exit}' /proc/cpuinfo)"
+    echo "cpus=$(nproc)"
+    echo "mem_total_kb=$(awk '/^MemTotal/ {print $2}' /proc/meminfo)"
+fi
+echo "disk_free_kb=$(df -Pk "$HOME" | awk 'NR == 2 {print $4}')"
+command -v go >/dev/null 2>&1 && echo "tool_go=$(go version | awk '{print $3}' | sed 's/^go//')"
+command -v node >/dev/null 2>&1 && echo "tool_node=$(node -v | sed 's/^v//')"
+command -v docker >/dev/null 2>&1 && echo "tool_docker=$(docker --version | awk '{print $3}' | tr -d ,)"
+command -v rsync >/dev/null 2>&1 && echo "tool_rsync=$(rsync --version | awk 'NR == 1 {print $3}')"
+true
+`
+
+// factsMarker separates the load metrics from the facts when both are
+// collected in one round trip
+const factsMarker = "--- facts ---"
+
+// parseFacts reads the key=value lines printed by factsScript
+func parseFacts(host, output string) (*Facts, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+
+	if values["os"] == "" {
+		return nil, fmt.Errorf("unexpected facts format")
+	}
+
+	facts := &Facts{
+		Host:        host,
+		OS:          strings.ToLower(values["os"]),
+		Kernel:      values["kernel"],
+		Arch:        goArch(values["arch"]),
+		CPUModel:    values["cpu_model"],
+		CollectedAt: time.Now(),
+	}
+	facts.CPUs, _ = strconv.Atoi(values["cpus"])
+	if kb, err := strconv.Atoi(values["mem_total_kb"]); err == nil {
+		facts.MemTotalMB = kb / 1024
+	}
+	if kb, err := strconv.Atoi(values["disk_free_kb"]); err == nil {
+		facts.DiskFreeMB = kb / 1024
+	}
+
+	for _, tool := range Tools {
+		if version := values["tool_"+tool]; version != "" {
+			if facts.Tools == nil {
+				facts.Tools = make(map[string]string)
+			}
+			facts.Tools[tool] = version
+		}
+	}
+
+	return facts, nil
+}
+
+// Labels returns the facts as selector labels: os, arch, kernel, ram
+// (e.g. "64G") and one label per installed tool holding its version
+func (f *Facts) Labels() map[string]string {
+	labels := map[string]string{
+		LabelOS:     f.OS,
+		LabelArch:   f.Arch,
+		LabelKernel: f.Kernel,
+	}
+	if f.MemTotalMB > 0 {
+		labels[LabelRAM] = strconv.Itoa(int(math.Round(float64(f.MemTotalMB)/1024))) + "G"
+	}
+	maps.Copy(labels, f.Tools)
+
+	for name, value := range labels {
+		if value == "" {
+			delete(labels, name)
+		}
+	}
+	return labels
+}
+
+// Age returns how long ago the facts were collected
+func (f *Facts) Age() time.Duration {
+	return time.Since(f.CollectedAt)
+}
+
+// FactsCache keeps the facts of every probed host on disk so they are only
+// collected again once they are older than TTL
+type FactsCache struct {
+	// TTL is how long facts stay fresh
+	TTL time.Duration
+	// Refresh treats every cached entry as stale
+	Refresh bool
+
+	path  string
+	mu    sync.Mutex
+	facts map[string]*Facts
+}
+
+// FactsCachePath returns the path to the facts cache file
+func FactsCachePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "distributed", "facts.json"), nil
+}
+
+// OpenFactsCache loads the facts cache. A missing or unreadable cache
+// starts empty, since it can always be rebuilt.
+func OpenFactsCache(ttl time.Duration) (*FactsCache, error) {
+	path, err := FactsCachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &FactsCache{TTL: ttl, path: path, facts: make(map[string]*Facts)}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &c.facts)
+	}
+	return c, nil
+}
+
+// Fresh returns the cached facts of host if they are younger than TTL
+func (c *FactsCache) Fresh(host string) (*Facts, bool) {
+	if c.Refresh {
+		return nil, false
+	}
+	facts, ok := c.Lookup(host)
+	if !ok || facts.Age() > c.TTL {
+		return nil, false
+	}
+	return facts, true
+}
+
+// Lookup returns the cached facts of host however old they are
+func (c *FactsCache) Lookup(host string) (*Facts, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	facts, ok := c.facts[host]
+	return facts, ok
+}
+
+// Put stores freshly collected facts and writes the cache
+func (c *FactsCache) Put(facts *Facts) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.facts[facts.Host] = facts
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c.facts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Replace the file in one step so concurrent readers never see it
+	// half written
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
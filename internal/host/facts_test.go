@@ -0,0 +1,148 @@
+package host
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+const factsOutput = `os=Linux
+kernel=6.8.0-45-generic
+arch=x86_64
+cpu_model=AMD Ryzen 9 7950X 16-Core Processor
+cpus=32
+mem_total_kb=65536000
+disk_free_kb=524288000
+tool_go=1.22.1
+tool_rsync=3.2.7
+`
+
+func TestParseFacts(t *testing.T) {
+	facts, err := parseFacts("homelab", factsOutput)
+	if err != nil {
+		t.Fatalf("parseFacts failed: %v", err)
+	}
+
+	if facts.Host != "homelab" || facts.OS != "linux" || facts.Arch != "amd64" ||
+		facts.Kernel != "6.8.0-45-generic" || facts.CPUModel != "AMD Ryzen 9 7950X 16-Core Processor" ||
+		facts.CPUs != 32 || facts.MemTotalMB != 64000 || facts.DiskFreeMB != 512000 {
+		t.Errorf("Unexpected facts: %+v", facts)
+	}
+	if want := map[string]string{"go": "1.22.1", "rsync": "3.2.7"}; !reflect.DeepEqual(facts.Tools, want) {
+		t.Errorf("Expected tools %v, got %v", want, facts.Tools)
+	}
+
+	if _, err := parseFacts("broken", "garbage"); err == nil {
+		t.Error("Expected error for malformed output")
+	}
+}
+
+func TestFacts_Labels(t *testing.T) {
+	facts := &Facts{OS: "linux", Arch: "arm64", MemTotalMB: 7900, Tools: map[string]string{"docker": "27.1.1"}}
+
+	want := map[string]string{"os": "linux", "arch": "arm64", "ram": "8G", "docker": "27.1.1"}
+	if got := facts.Labels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Labels() = %v, want %v", got, want)
+	}
+}
+
+func TestFactsCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cache, err := OpenFactsCache(time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFactsCache failed: %v", err)
+	}
+	if _, ok := cache.Fresh("homelab"); ok {
+		t.Fatal("Expected empty cache")
+	}
+
+	if err := cache.Put(&Facts{Host: "homelab", OS: "linux", CollectedAt: time.Now()}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := cache.Put(&Facts{Host: "old", OS: "linux", CollectedAt: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// A new cache reads what the first one wrote
+	cache, err = OpenFactsCache(time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFactsCache failed: %v", err)
+	}
+	if facts, ok := cache.Fresh("homelab"); !ok || facts.OS != "linux" {
+		t.Errorf("Expected fresh facts for homelab, got %+v", facts)
+	}
+	if _, ok := cache.Fresh("old"); ok {
+		t.Error("Expected facts older than the TTL to be stale")
+	}
+	if _, ok := cache.Lookup("old"); !ok {
+		t.Error("Expected Lookup to return stale facts")
+	}
+
+	cache.Refresh = true
+	if _, ok := cache.Fresh("homelab"); ok {
+		t.Error("Expected Refresh to make every entry stale")
+	}
+}
+
+func TestProbe_CollectsFactsOnce(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"homelab": {Respond: func(command string) (string, int) {
+			out := probeOutput(0.5, 32, 2, 20)
+			if strings.Contains(command, factsMarker) {
+				out += factsMarker + "\n" + factsOutput
+			}
+			return out, 0
+		}},
+	})
+
+	cache, err := OpenFactsCache(time.Hour)
+	if err != nil {
+		t.Fatalf("OpenFactsCache failed: %v", err)
+	}
+	opts := ProbeOptions{
+		Facts: cache,
+		Scoring: config.Scoring{Labels: map[string]config.HostScoring{
+			"go": {Bias: -10},
+		}},
+	}
+
+	for i := range 2 {
+		info, err := probe(context.Background(), fake, "homelab", opts)
+		if err != nil {
+			t.Fatalf("probe %d failed: %v", i, err)
+		}
+		if info.Facts == nil || info.Facts.CPUModel == "" {
+			t.Fatalf("probe %d: expected facts, got %+v", i, info.Facts)
+		}
+		if info.Labels["go"] != "1.22.1" || info.Labels["ram"] != "63G" {
+			t.Errorf("probe %d: expected facts labels, got %v", i, info.Labels)
+		}
+		if info.Bias != -10 {
+			t.Errorf("probe %d: expected label scoring bias -10, got %.2f", i, info.Bias)
+		}
+	}
+
+	var collected int
+	for _, call := range fake.Calls() {
+		if strings.Contains(call.Command, factsMarker) {
+			collected++
+		}
+	}
+	if collected != 1 {
+		t.Errorf("Expected facts to be collected once, got %d", collected)
+	}
+
+	path, _ := FactsCachePath()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected facts cache at %s: %v", path, err)
+	}
+}
@@ -3,49 +3,59 @@ package host
 import (
 	"context"
 	"fmt"
-	"os/exec"
+	"maps"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/remote"
+	"github.com/WillyV3/distributed/internal/transport"
 )
 
 // LoadInfo contains host load metrics
 type LoadInfo struct {
-	Host      string
-	Load      float64
-	CPUs      int
-	CPUPct    int
-	MemPct    int
-	Score     float64
-	Reachable bool
+	Host        string  `json:"host" yaml:"host"`
+	Load        float64 `json:"load" yaml:"load"`
+	CPUs        int     `json:"cpus" yaml:"cpus"`
+	CPUPct      int     `json:"cpu_pct" yaml:"cpu_pct"`
+	MemPct      int     `json:"mem_pct" yaml:"mem_pct"`
+	DiskFreePct int     `json:"disk_free_pct" yaml:"disk_free_pct"`
+	SwapPct     int     `json:"swap_pct" yaml:"swap_pct"`
+	IOWaitPct   int     `json:"iowait_pct" yaml:"iowait_pct"`
+	Jobs        int     `json:"jobs" yaml:"jobs"`
+	Score       float64 `json:"score" yaml:"score"`
+	Terms       []Term  `json:"terms,omitempty" yaml:"terms,omitempty"`
+	HostWeight  float64 `json:"host_weight,omitempty" yaml:"host_weight,omitempty"`
+	Bias        float64 `json:"bias,omitempty" yaml:"bias,omitempty"`
+	Reachable   bool    `json:"reachable" yaml:"reachable"`
+	// Labels are the labels detected on the host merged with those
+	// configured for it
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Facts are the host's cached or freshly collected facts, when the
+	// probe used a FactsCache
+	Facts *Facts `json:"facts,omitempty" yaml:"facts,omitempty"`
 }
 
-// CheckReachable tests if a host is reachable via SSH
-func CheckReachable(host string, timeout time.Duration) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "ssh",
-		"-o", "ConnectTimeout=2",
-		"-o", "BatchMode=yes",
-		host, "exit")
-
-	return cmd.Run() == nil
+// Term is one weighted metric contributing to a score
+type Term struct {
+	Metric string  `json:"metric" yaml:"metric"`
+	Value  float64 `json:"value" yaml:"value"`
+	Weight float64 `json:"weight" yaml:"weight"`
 }
 
-// GetLoad retrieves load information from a host
-func GetLoad(host string) (*LoadInfo, error) {
-	// Check if reachable first
-	if !CheckReachable(host, 2*time.Second) {
-		return &LoadInfo{
-			Host:      host,
-			Reachable: false,
-		}, nil
-	}
+// Contribution returns the term's share of the score
+func (t Term) Contribution() float64 {
+	return t.Value * t.Weight
+}
 
-	// Get load metrics via SSH
-	script := `
+// probeScript collects raw metrics as key=value lines
+var probeScript = `
 load=$(uptime | sed "s/.*load average[s]*: //" | awk "{print \$1}" | tr -d ",")
+swap_pct=0
+iowait=0
 
 if [[ "$OSTYPE" == "darwin"* ]]; then
     cpus=$(sysctl -n hw.ncpu)
@@ -55,56 +65,220 @@ if [[ "$OSTYPE" == "darwin"* ]]; then
     pages_compressed=$(vm_stat | grep "occupied by compressor" | awk "{print \$5}" | tr -d ".")
     mem_used=$(( (pages_wired + pages_compressed) * page_size ))
     mem_pct=$((mem_used * 100 / mem_total))
+    swap_pct=$(sysctl -n vm.swapusage | awk "{t = \$3; u = \$6; sub(\"M\", \"\", t); sub(\"M\", \"\", u); if (t > 0) printf \"%.0f\", u * 100 / t; else print 0}")
 else
     cpus=$(nproc)
     mem_info=$(free | grep Mem)
     mem_total=$(echo "$mem_info" | awk "{print \$2}")
     mem_used=$(echo "$mem_info" | awk "{print \$3}")
     mem_pct=$((mem_used * 100 / mem_total))
+    swap_pct=$(free | awk "/^Swap/ {if (\$2 > 0) printf \"%.0f\", \$3 * 100 / \$2; else print 0}")
+    stat1=$(awk "/^cpu / {print \$6, \$2 + \$3 + \$4 + \$5 + \$6 + \$7 + \$8}" /proc/stat)
+    sleep 0.2
+    stat2=$(awk "/^cpu / {print \$6, \$2 + \$3 + \$4 + \$5 + \$6 + \$7 + \$8}" /proc/stat)
+    iowait=$(echo "$stat1 $stat2" | awk "{d = \$4 - \$2; if (d > 0) printf \"%.0f\", (\$3 - \$1) * 100 / d; else print 0}")
 fi
 
 cpu_pct=$(awk "BEGIN {printf \"%.0f\", ($load / $cpus) * 100}")
-score=$(awk "BEGIN {printf \"%.2f\", ($cpu_pct * 0.7) + ($mem_pct * 0.3)}")
+disk_free=$(df -P "$HOME" | awk "NR == 2 {print 100 - \$5}")
+` + remote.CountJobs + `
 
-echo "$load|$cpus|$cpu_pct|$mem_pct|$score"
+echo "load=$load"
+echo "cpus=$cpus"
+echo "cpu_pct=$cpu_pct"
+echo "mem_pct=$mem_pct"
+echo "disk_free=$disk_free"
+echo "swap_pct=$swap_pct"
+echo "iowait=$iowait"
+echo "jobs=$jobs"
+echo "os=$(uname -s)"
+echo "arch=$(uname -m)"
 `
 
-	cmd := exec.Command("ssh", "-o", "LogLevel=QUIET", host, script)
-	output, err := cmd.Output()
+// CheckReachable tests if a host is reachable via SSH within timeout,
+// giving up early when ctx is done
+func CheckReachable(ctx context.Context, t transport.Transport, host string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return t.Check(ctx, host)
+}
+
+// GetLoad retrieves load information from a host and scores it
+func GetLoad(ctx context.Context, t transport.Transport, host string, scoring config.Scoring) (*LoadInfo, error) {
+	return probe(ctx, t, host, ProbeOptions{Scoring: scoring})
+}
+
+// probe retrieves load information from a host, labels it and scores it.
+// With opts.Facts the host's facts are collected in the same round trip
+// unless fresh ones are cached.
+func probe(ctx context.Context, t transport.Transport, host string, opts ProbeOptions) (*LoadInfo, error) {
+	// Check if reachable first
+	if !CheckReachable(ctx, t, host, 2*time.Second) {
+		return &LoadInfo{
+			Host:      host,
+			Reachable: false,
+			Labels:    mergeLabels(nil, opts.Labels[host]),
+		}, nil
+	}
+
+	var facts *Facts
+	script := probeScript
+	if opts.Facts != nil {
+		var fresh bool
+		if facts, fresh = opts.Facts.Fresh(host); !fresh {
+			script += "echo '" + factsMarker + "'\n" + factsScript
+		}
+	}
+
+	// Get load metrics via SSH
+	output, err := t.Output(ctx, host, script)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get load: %w", err)
 	}
 
-	// Parse output: load|cpus|cpu_pct|mem_pct|score
-	parts := strings.Split(strings.TrimSpace(string(output)), "|")
-	if len(parts) != 5 {
-		return nil, fmt.Errorf("unexpected output format")
+	metrics, factsOutput, collected := strings.Cut(string(output), factsMarker+"\n")
+	info, err := parseMetrics(host, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	if collected {
+		if f, err := parseFacts(host, factsOutput); err == nil {
+			facts = f
+			// The cache is only an optimisation; facts are collected
+			// again next time if it can't be written
+			opts.Facts.Put(f)
+		}
+	}
+	if facts != nil {
+		info.Facts = facts
+		info.Labels = mergeLabels(info.Labels, facts.Labels())
+	}
+	info.Labels = mergeLabels(info.Labels, opts.Labels[host])
+
+	ApplyScore(info, opts.Scoring)
+	return info, nil
+}
+
+// parseMetrics reads the key=value lines printed by probeScript
+func parseMetrics(host, output string) (*LoadInfo, error) {
+	values := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			values[key] = value
+		}
 	}
 
-	load, _ := strconv.ParseFloat(parts[0], 64)
-	cpus, _ := strconv.Atoi(parts[1])
-	cpuPct, _ := strconv.Atoi(parts[2])
-	memPct, _ := strconv.Atoi(parts[3])
-	score, _ := strconv.ParseFloat(parts[4], 64)
+	for _, required := range []string{"load", "cpus", "cpu_pct", "mem_pct"} {
+		if _, ok := values[required]; !ok {
+			return nil, fmt.Errorf("unexpected output format")
+		}
+	}
 
-	return &LoadInfo{
-		Host:      host,
-		Load:      load,
-		CPUs:      cpus,
-		CPUPct:    cpuPct,
-		MemPct:    memPct,
-		Score:     score,
-		Reachable: true,
-	}, nil
+	info := &LoadInfo{Host: host, Reachable: true}
+	info.Load, _ = strconv.ParseFloat(values["load"], 64)
+	info.CPUs, _ = strconv.Atoi(values["cpus"])
+	info.CPUPct, _ = strconv.Atoi(values["cpu_pct"])
+	info.MemPct, _ = strconv.Atoi(values["mem_pct"])
+	info.DiskFreePct, _ = strconv.Atoi(values["disk_free"])
+	info.SwapPct, _ = strconv.Atoi(values["swap_pct"])
+	info.IOWaitPct, _ = strconv.Atoi(values["iowait"])
+	info.Jobs, _ = strconv.Atoi(values["jobs"])
+	info.Labels = detectLabels(values["os"], values["arch"])
+
+	// Hosts that don't report disk usage shouldn't look full
+	if _, ok := values["disk_free"]; !ok {
+		info.DiskFreePct = 100
+	}
+
+	return info, nil
+}
+
+// Metric returns the raw value of a scoring metric
+func (l *LoadInfo) Metric(name string) float64 {
+	switch name {
+	case config.MetricCPU:
+		return float64(l.CPUPct)
+	case config.MetricMem:
+		return float64(l.MemPct)
+	case config.MetricDisk:
+		return float64(100 - l.DiskFreePct)
+	case config.MetricSwap:
+		return float64(l.SwapPct)
+	case config.MetricIOWait:
+		return float64(l.IOWaitPct)
+	case config.MetricJobs:
+		return float64(l.Jobs)
+	}
+	return 0
 }
 
-// FindBest finds the host with the lowest load score
-func FindBest(hosts []string) (*LoadInfo, error) {
+// ApplyScore computes the score of a host from its raw metrics.
+// The weighted sum of metrics is multiplied by the host's weight and
+// offset by its bias, then rounded to two decimals. Weights and biases
+// of every label selector the host matches are combined with the
+// host's own.
+func ApplyScore(info *LoadInfo, scoring config.Scoring) {
+	weights := scoring.EffectiveWeights()
+
+	info.Terms = nil
+	score := 0.0
+	for _, metric := range config.Metrics {
+		if weights[metric] == 0 {
+			continue
+		}
+		term := Term{Metric: metric, Value: info.Metric(metric), Weight: weights[metric]}
+		info.Terms = append(info.Terms, term)
+		score += term.Contribution()
+	}
+
+	info.HostWeight = 1
+	info.Bias = 0
+	adjustments := []config.HostScoring{scoring.Hosts[info.Host]}
+	for _, selector := range slices.Sorted(maps.Keys(scoring.Labels)) {
+		// Selectors are validated when the config is loaded
+		if sel, err := ParseSelector(selector); err == nil && sel.Matches(info.Labels) {
+			adjustments = append(adjustments, scoring.Labels[selector])
+		}
+	}
+	for _, adjust := range adjustments {
+		if adjust.Weight != 0 {
+			info.HostWeight *= adjust.Weight
+		}
+		info.Bias += adjust.Bias
+	}
+
+	info.Score = math.Round((score*info.HostWeight+info.Bias)*100) / 100
+}
+
+// Breakdown describes how the score was built, e.g. "cpu 35.00 + mem 15.00 × 0.50 + bias -10.00"
+func (l *LoadInfo) Breakdown() string {
+	var parts []string
+	for _, term := range l.Terms {
+		parts = append(parts, fmt.Sprintf("%s %.2f", term.Metric, term.Contribution()))
+	}
+
+	s := strings.Join(parts, " + ")
+	if s == "" {
+		s = "0"
+	}
+	if l.HostWeight != 0 && l.HostWeight != 1 {
+		s += fmt.Sprintf(" × %.2f", l.HostWeight)
+	}
+	if l.Bias != 0 {
+		s += fmt.Sprintf(" + bias %.2f", l.Bias)
+	}
+	return s
+}
+
+// FindBest finds the host with the lowest load score among those
+// matching opts.Selector. Hosts are probed concurrently; ties go to the
+// earlier host.
+func FindBest(ctx context.Context, t transport.Transport, hosts []string, opts ProbeOptions) (*LoadInfo, error) {
 	var best *LoadInfo
 
-	for _, host := range hosts {
-		info, err := GetLoad(host)
-		if err != nil || !info.Reachable {
+	for _, info := range ProbeAll(ctx, t, hosts, opts, nil) {
+		if !opts.Accepts(info) {
 			continue
 		}
 
@@ -114,6 +288,9 @@ func FindBest(hosts []string) (*LoadInfo, error) {
 	}
 
 	if best == nil {
+		if !opts.Selector.Empty() {
+			return nil, fmt.Errorf("no reachable hosts match selector %q", opts.Selector)
+		}
 		return nil, fmt.Errorf("no reachable hosts found")
 	}
 
@@ -1,7 +1,13 @@
 package host
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/transport"
 )
 
 func TestFindBest_SelectsLowestScore(t *testing.T) {
@@ -102,7 +108,7 @@ func TestFindBest_SelectsLowestScore(t *testing.T) {
 }
 
 func TestLoadInfo_ScoreCalculation(t *testing.T) {
-	// Test the expected score calculation: (cpu_pct * 0.7) + (mem_pct * 0.3)
+	// Test the default score calculation: (cpu_pct * 0.7) + (mem_pct * 0.3)
 	tests := []struct {
 		name      string
 		cpuPct    int
@@ -143,11 +149,12 @@ func TestLoadInfo_ScoreCalculation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Calculate score using the same formula as in the bash script
-			score := float64(tt.cpuPct)*0.7 + float64(tt.memPct)*0.3
+			// Default scoring reproduces the original formula
+			info := &LoadInfo{Host: "host", CPUPct: tt.cpuPct, MemPct: tt.memPct}
+			ApplyScore(info, config.Scoring{})
 
-			if score != tt.wantScore {
-				t.Errorf("Expected score %.2f, got %.2f", tt.wantScore, score)
+			if info.Score != tt.wantScore {
+				t.Errorf("Expected score %.2f, got %.2f", tt.wantScore, info.Score)
 			}
 		})
 	}
@@ -229,3 +236,190 @@ func TestLoadInfo_Comparison(t *testing.T) {
 		t.Errorf("Expected minimum score 25.0, got %.2f", min.Score)
 	}
 }
+
+func TestFindBest_WithFakeTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		hosts    map[string]*transport.FakeHost
+		order    []string
+		wantHost string
+		wantErr  bool
+	}{
+		{
+			name: "lowest score wins",
+			hosts: map[string]*transport.FakeHost{
+				"busy": {Stdout: probeOutput(3.50, 4, 88, 70)},
+				"idle": {Stdout: probeOutput(0.10, 8, 1, 20)},
+			},
+			order:    []string{"busy", "idle"},
+			wantHost: "idle",
+		},
+		{
+			name: "offline hosts are skipped",
+			hosts: map[string]*transport.FakeHost{
+				"down": {Offline: true},
+				"up":   {Stdout: probeOutput(1.00, 2, 50, 50)},
+			},
+			order:    []string{"down", "up"},
+			wantHost: "up",
+		},
+		{
+			name: "slow hosts past the reachability timeout are skipped",
+			hosts: map[string]*transport.FakeHost{
+				"slow": {Delay: 3 * time.Second, Stdout: probeOutput(0.00, 4, 0, 0)},
+				"ok":   {Stdout: probeOutput(2.00, 4, 50, 50)},
+			},
+			order:    []string{"slow", "ok"},
+			wantHost: "ok",
+		},
+		{
+			name: "malformed metrics are skipped",
+			hosts: map[string]*transport.FakeHost{
+				"broken": {Stdout: "garbage\n"},
+				"ok":     {Stdout: probeOutput(2.00, 4, 50, 50)},
+			},
+			order:    []string{"broken", "ok"},
+			wantHost: "ok",
+		},
+		{
+			name: "no reachable hosts",
+			hosts: map[string]*transport.FakeHost{
+				"down": {Offline: true},
+			},
+			order:   []string{"down", "unknown"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			best, err := FindBest(context.Background(), transport.NewFake(tt.hosts), tt.order, ProbeOptions{})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got host %s", best.Host)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("FindBest failed: %v", err)
+			}
+			if best.Host != tt.wantHost {
+				t.Errorf("Expected host %s, got %s", tt.wantHost, best.Host)
+			}
+		})
+	}
+}
+
+func TestGetLoad_ParsesMetrics(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"homelab": {Stdout: probeOutput(1.25, 32, 4, 37)},
+	})
+
+	info, err := GetLoad(context.Background(), fake, "homelab", config.Scoring{})
+	if err != nil {
+		t.Fatalf("GetLoad failed: %v", err)
+	}
+
+	if info.Host != "homelab" || info.Load != 1.25 || info.CPUs != 32 ||
+		info.CPUPct != 4 || info.MemPct != 37 || !info.Reachable {
+		t.Errorf("Unexpected metrics: %+v", info)
+	}
+	if info.Score != 13.90 {
+		t.Errorf("Expected default score 13.90, got %.2f", info.Score)
+	}
+}
+
+// probeOutput formats metrics the way the remote probe script prints them
+func probeOutput(load float64, cpus, cpuPct, memPct int) string {
+	return fmt.Sprintf("load=%.2f\ncpus=%d\ncpu_pct=%d\nmem_pct=%d\ndisk_free=80\nswap_pct=0\niowait=0\njobs=0\n",
+		load, cpus, cpuPct, memPct)
+}
+
+func TestParseMetrics(t *testing.T) {
+	info, err := parseMetrics("homelab", "load=0.50\ncpus=8\ncpu_pct=6\nmem_pct=40\ndisk_free=25\nswap_pct=10\niowait=3\njobs=2\n")
+	if err != nil {
+		t.Fatalf("parseMetrics failed: %v", err)
+	}
+
+	if info.DiskFreePct != 25 || info.SwapPct != 10 || info.IOWaitPct != 3 || info.Jobs != 2 {
+		t.Errorf("Unexpected extended metrics: %+v", info)
+	}
+
+	// Older probes without the extended metrics still parse
+	info, err = parseMetrics("old", "load=0.50\ncpus=8\ncpu_pct=6\nmem_pct=40\n")
+	if err != nil {
+		t.Fatalf("parseMetrics failed on minimal output: %v", err)
+	}
+	if info.DiskFreePct != 100 {
+		t.Errorf("Expected missing disk metric to read as fully free, got %d", info.DiskFreePct)
+	}
+
+	if _, err := parseMetrics("broken", "garbage"); err == nil {
+		t.Error("Expected error for malformed output")
+	}
+}
+
+func TestApplyScore(t *testing.T) {
+	base := LoadInfo{Host: "homelab", CPUPct: 50, MemPct: 40, DiskFreePct: 30, SwapPct: 20, IOWaitPct: 10, Jobs: 2,
+		Labels: map[string]string{"os": "linux", "go": "1.22.1"}}
+
+	tests := []struct {
+		name          string
+		scoring       config.Scoring
+		wantScore     float64
+		wantBreakdown string
+	}{
+		{
+			name:          "default weights",
+			scoring:       config.Scoring{},
+			wantScore:     47.0, // (50 * 0.7) + (40 * 0.3)
+			wantBreakdown: "cpu 35.00 + mem 12.00",
+		},
+		{
+			name: "extra terms",
+			scoring: config.Scoring{Weights: map[string]float64{
+				"cpu": 0.5, "mem": 0, "disk": 0.1, "swap": 0.2, "iowait": 1, "jobs": 5,
+			}},
+			wantScore:     56.0, // 25 + 7 + 4 + 10 + 10
+			wantBreakdown: "cpu 25.00 + disk 7.00 + swap 4.00 + iowait 10.00 + jobs 10.00",
+		},
+		{
+			name: "host weight and bias",
+			scoring: config.Scoring{Hosts: map[string]config.HostScoring{
+				"homelab": {Weight: 0.5, Bias: -10},
+				"laptop":  {Bias: 100},
+			}},
+			wantScore:     13.5, // 47 * 0.5 - 10
+			wantBreakdown: "cpu 35.00 + mem 12.00 × 0.50 + bias -10.00",
+		},
+		{
+			name: "label adjustments",
+			scoring: config.Scoring{
+				Hosts: map[string]config.HostScoring{"homelab": {Bias: -2}},
+				Labels: map[string]config.HostScoring{
+					"go":        {Bias: -3},
+					"os=linux":  {Weight: 0.5},
+					"os=darwin": {Bias: 100},
+				},
+			},
+			wantScore:     18.5, // 47 * 0.5 - 2 - 3
+			wantBreakdown: "cpu 35.00 + mem 12.00 × 0.50 + bias -5.00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := base
+			ApplyScore(&info, tt.scoring)
+
+			if info.Score != tt.wantScore {
+				t.Errorf("Expected score %.2f, got %.2f", tt.wantScore, info.Score)
+			}
+			if got := info.Breakdown(); got != tt.wantBreakdown {
+				t.Errorf("Expected breakdown %q, got %q", tt.wantBreakdown, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package host
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/WillyV3/distributed/internal/config"
+)
+
+// Labels dw detects on reachable hosts. os and arch come with every
+// probe; kernel, ram and tool versions come from Facts.
+const (
+	LabelOS     = "os"
+	LabelArch   = "arch"
+	LabelKernel = "kernel"
+	LabelRAM    = "ram"
+)
+
+// archNames maps uname -m output to Go's architecture names
+var archNames = map[string]string{
+	"x86_64":  "amd64",
+	"amd64":   "amd64",
+	"aarch64": "arm64",
+	"arm64":   "arm64",
+	"i386":    "386",
+	"i686":    "386",
+	"armv7l":  "arm",
+	"armv6l":  "arm",
+}
+
+// detectLabels turns uname -s and uname -m output into labels, e.g.
+// os=linux and arch=amd64
+func detectLabels(kernel, machine string) map[string]string {
+	labels := make(map[string]string)
+	if kernel != "" {
+		labels[LabelOS] = strings.ToLower(kernel)
+	}
+	if machine != "" {
+		labels[LabelArch] = goArch(machine)
+	}
+	return labels
+}
+
+// goArch returns Go's name for the architecture uname -m reports
+func goArch(machine string) string {
+	if arch, ok := archNames[machine]; ok {
+		return arch
+	}
+	return machine
+}
+
+// mergeLabels returns detected labels overridden by configured ones
+func mergeLabels(detected, configured map[string]string) map[string]string {
+	if len(detected) == 0 && len(configured) == 0 {
+		return nil
+	}
+	labels := maps.Clone(detected)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	maps.Copy(labels, configured)
+	return labels
+}
+
+// ValidateScoring checks that every label selector in scoring parses
+func ValidateScoring(scoring config.Scoring) error {
+	for selector := range scoring.Labels {
+		if _, err := ParseSelector(selector); err != nil {
+			return fmt.Errorf("scoring labels: %w", err)
+		}
+	}
+	return nil
+}
+
+// requirement is one comma-separated term of a selector
+type requirement struct {
+	key   string
+	value string
+	// op is "=", "!=", "exists" or "!exists"
+	op string
+}
+
+// Selector filters hosts by their labels. The zero Selector matches
+// every host.
+type Selector struct {
+	reqs []requirement
+	text string
+}
+
+// ParseSelector parses a comma-separated list of requirements: key=value,
+// key!=value, key (the label is set) and !key (the label is not set).
+// All of them must hold for a host to match.
+func ParseSelector(s string) (Selector, error) {
+	sel := Selector{text: s}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var req requirement
+		switch {
+		case strings.Contains(term, "!="):
+			req.key, req.value, _ = strings.Cut(term, "!=")
+			req.op = "!="
+		case strings.Contains(term, "="):
+			req.key, req.value, _ = strings.Cut(term, "=")
+			req.op = "="
+		case strings.HasPrefix(term, "!"):
+			req.key = strings.TrimPrefix(term, "!")
+			req.op = "!exists"
+		default:
+			req.key = term
+			req.op = "exists"
+		}
+
+		req.key, req.value = strings.TrimSpace(req.key), strings.TrimSpace(req.value)
+		if req.key == "" || strings.ContainsAny(req.key, "=! ") {
+			return Selector{}, fmt.Errorf("invalid selector term %q", term)
+		}
+		sel.reqs = append(sel.reqs, req)
+	}
+	return sel, nil
+}
+
+// Empty reports whether the selector matches every host
+func (s Selector) Empty() bool {
+	return len(s.reqs) == 0
+}
+
+// String returns the selector as it was written
+func (s Selector) String() string {
+	return s.text
+}
+
+// Matches reports whether labels satisfy every requirement
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s.reqs {
+		value, ok := labels[req.key]
+		switch req.op {
+		case "=":
+			if !ok || value != req.value {
+				return false
+			}
+		case "!=":
+			if ok && value == req.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package host
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+func TestDetectLabels(t *testing.T) {
+	tests := []struct {
+		kernel, machine string
+		want            map[string]string
+	}{
+		{"Linux", "x86_64", map[string]string{"os": "linux", "arch": "amd64"}},
+		{"Darwin", "arm64", map[string]string{"os": "darwin", "arch": "arm64"}},
+		{"Linux", "aarch64", map[string]string{"os": "linux", "arch": "arm64"}},
+		{"FreeBSD", "riscv64", map[string]string{"os": "freebsd", "arch": "riscv64"}},
+		{"", "", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		if got := detectLabels(tt.kernel, tt.machine); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("detectLabels(%q, %q) = %v, want %v", tt.kernel, tt.machine, got, tt.want)
+		}
+	}
+}
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"os": "linux", "arch": "amd64", "docker": "true"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"os=linux", true},
+		{"os=linux,arch=amd64", true},
+		{" os = linux , arch=amd64 ", true},
+		{"os=darwin", false},
+		{"os=linux,arch=arm64", false},
+		{"arch!=arm64", true},
+		{"os!=linux", false},
+		{"docker", true},
+		{"gpu", false},
+		{"!gpu", true},
+		{"!docker", false},
+		{"gpu!=true", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("ParseSelector(%q) failed: %v", tt.selector, err)
+			}
+			if got := sel.Matches(labels); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelector_Invalid(t *testing.T) {
+	for _, s := range []string{"=linux", "!", "os linux=1", "!=x"} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("ParseSelector(%q) should fail", s)
+		}
+	}
+}
+
+func TestFindBest_Selector(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"mac":   {Stdout: probeOutput(0.10, 8, 1, 20) + "os=Darwin\narch=arm64\n"},
+		"linux": {Stdout: probeOutput(2.00, 4, 50, 50) + "os=Linux\narch=x86_64\n"},
+		"gpu":   {Stdout: probeOutput(3.00, 4, 75, 50) + "os=Linux\narch=x86_64\n"},
+	})
+	hosts := []string{"mac", "linux", "gpu"}
+	configured := map[string]map[string]string{
+		"gpu": {"gpu": "true"},
+		// Configured labels win over detected ones
+		"mac": {"os": "linux"},
+	}
+
+	tests := []struct {
+		selector string
+		want     string
+		wantErr  bool
+	}{
+		{selector: "", want: "mac"},
+		{selector: "arch=amd64", want: "linux"},
+		{selector: "gpu", want: "gpu"},
+		{selector: "os=linux,arch=arm64", want: "mac"},
+		{selector: "os=windows", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			best, err := FindBest(context.Background(), fake, hosts, ProbeOptions{Labels: configured, Selector: sel})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got host %s", best.Host)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindBest failed: %v", err)
+			}
+			if best.Host != tt.want {
+				t.Errorf("FindBest() = %s, want %s", best.Host, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package host
+
+import (
+	"context"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+// Default probing limits
+const (
+	DefaultWorkers  = 8
+	DefaultDeadline = 10 * time.Second
+)
+
+// ProbeOptions bounds concurrent probing of many hosts
+type ProbeOptions struct {
+	// Workers is the maximum number of hosts probed at once
+	Workers int
+	// Deadline is the total time allowed for all probes
+	Deadline time.Duration
+	// Scoring turns each host's metrics into a score
+	Scoring config.Scoring
+	// Labels are the labels configured per host, added to those detected
+	Labels map[string]map[string]string
+	// Selector limits which hosts FindBest and Accepts consider
+	Selector Selector
+	// Facts, if set, caches each host's facts; probes collect them again
+	// once they are stale
+	Facts *FactsCache
+}
+
+// Accepts reports whether a probed host is reachable and matches the
+// selector
+func (o ProbeOptions) Accepts(info *LoadInfo) bool {
+	return info.Reachable && o.Selector.Matches(info.Labels)
+}
+
+// withDefaults fills unset options
+func (o ProbeOptions) withDefaults() ProbeOptions {
+	if o.Workers <= 0 {
+		o.Workers = DefaultWorkers
+	}
+	if o.Deadline <= 0 {
+		o.Deadline = DefaultDeadline
+	}
+	return o
+}
+
+// ProbeAll fetches load from every host concurrently. Each result is passed
+// to fn as soon as it arrives; fn may be nil. Hosts that fail or have not
+// answered by the deadline are reported unreachable. Labels configured in
+// opts are merged into every result. The returned slice is in the same
+// order as hosts. Probes still running when ctx is done or the deadline
+// passes are abandoned.
+func ProbeAll(ctx context.Context, t transport.Transport, hosts []string, opts ProbeOptions, fn func(*LoadInfo)) []*LoadInfo {
+	return fanOut(ctx, hosts, opts, func(ctx context.Context, h string) *LoadInfo {
+		info, err := probe(ctx, t, h, opts)
+		if err != nil || info == nil {
+			return &LoadInfo{Host: h, Labels: mergeLabels(nil, opts.Labels[h])}
+		}
+		return info
+	}, func(h string) *LoadInfo {
+		return &LoadInfo{Host: h, Labels: mergeLabels(nil, opts.Labels[h])}
+	}, fn)
+}
+
+// Reachability is the result of a connection check
+type Reachability struct {
+	Host      string `json:"host" yaml:"host"`
+	Reachable bool   `json:"reachable" yaml:"reachable"`
+}
+
+// CheckAll tests reachability of every host concurrently, streaming each
+// result to fn as it arrives. The returned slice is in hosts order.
+func CheckAll(ctx context.Context, t transport.Transport, hosts []string, timeout time.Duration, opts ProbeOptions, fn func(Reachability)) []Reachability {
+	return fanOut(ctx, hosts, opts, func(ctx context.Context, h string) Reachability {
+		return Reachability{Host: h, Reachable: CheckReachable(ctx, t, h, timeout)}
+	}, func(h string) Reachability {
+		return Reachability{Host: h}
+	}, fn)
+}
+
+// fanOut runs probe for each host on a bounded worker pool. Hosts still
+// pending at the deadline, or when ctx is done, get the value from
+// timedOut.
+func fanOut[T any](ctx context.Context, hosts []string, opts ProbeOptions, probe func(context.Context, string) T, timedOut func(string) T, fn func(T)) []T {
+	opts = opts.withDefaults()
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Deadline)
+	defer cancel()
+
+	type result struct {
+		index int
+		value T
+	}
+
+	jobs := make(chan int, len(hosts))
+	for i := range hosts {
+		jobs <- i
+	}
+	close(jobs)
+
+	// Buffered so workers never block after the deadline has passed
+	results := make(chan result, len(hosts))
+	for range min(opts.Workers, len(hosts)) {
+		go func() {
+			for i := range jobs {
+				// Hosts not started by the deadline are reported by the
+				// loop below; don't connect to them anymore
+				if ctx.Err() != nil {
+					continue
+				}
+				results <- result{i, probe(ctx, hosts[i])}
+			}
+		}()
+	}
+
+	out := make([]T, len(hosts))
+	done := make([]bool, len(hosts))
+	for range hosts {
+		select {
+		case r := <-results:
+			out[r.index] = r.value
+			done[r.index] = true
+			if fn != nil {
+				fn(r.value)
+			}
+		case <-ctx.Done():
+			for i, h := range hosts {
+				if !done[i] {
+					out[i] = timedOut(h)
+					if fn != nil {
+						fn(out[i])
+					}
+				}
+			}
+			return out
+		}
+	}
+
+	return out
+}
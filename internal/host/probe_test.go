@@ -0,0 +1,141 @@
+package host
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+func TestProbeAll_Concurrent(t *testing.T) {
+	hosts := map[string]*transport.FakeHost{}
+	var names []string
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		hosts[name] = &transport.FakeHost{Delay: 100 * time.Millisecond, Stdout: probeOutput(1.00, 4, 25, 50)}
+		names = append(names, name)
+	}
+
+	start := time.Now()
+	results := ProbeAll(context.Background(), transport.NewFake(hosts), names, ProbeOptions{Workers: 6}, nil)
+	elapsed := time.Since(start)
+
+	// Each probe takes two delays (check + metrics); sequentially this would be 1.2s
+	if elapsed > 600*time.Millisecond {
+		t.Errorf("Expected concurrent probing, took %s", elapsed)
+	}
+
+	for i, info := range results {
+		if info.Host != names[i] || !info.Reachable {
+			t.Errorf("results[%d] = %+v, want reachable %s", i, info, names[i])
+		}
+	}
+}
+
+func TestProbeAll_StreamsInArrivalOrder(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"slow": {Delay: 150 * time.Millisecond, Stdout: probeOutput(1.00, 4, 25, 50)},
+		"fast": {Stdout: probeOutput(1.00, 4, 25, 50)},
+	})
+
+	var arrived []string
+	results := ProbeAll(context.Background(), fake, []string{"slow", "fast"}, ProbeOptions{}, func(info *LoadInfo) {
+		arrived = append(arrived, info.Host)
+	})
+
+	if len(arrived) != 2 || arrived[0] != "fast" || arrived[1] != "slow" {
+		t.Errorf("Expected fast then slow, got %v", arrived)
+	}
+	if results[0].Host != "slow" || results[1].Host != "fast" {
+		t.Errorf("Expected results in input order, got %s, %s", results[0].Host, results[1].Host)
+	}
+}
+
+func TestProbeAll_Deadline(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"hung": {Delay: time.Second, Stdout: probeOutput(1.00, 4, 25, 50)},
+		"ok":   {Stdout: probeOutput(1.00, 4, 25, 50)},
+	})
+
+	var streamed int
+	start := time.Now()
+	results := ProbeAll(context.Background(), fake, []string{"hung", "ok"}, ProbeOptions{Deadline: 200 * time.Millisecond}, func(*LoadInfo) {
+		streamed++
+	})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected probing to stop at the deadline, took %s", elapsed)
+	}
+	if results[0].Reachable {
+		t.Error("Expected host past the deadline to be unreachable")
+	}
+	if !results[1].Reachable {
+		t.Error("Expected fast host to be reachable")
+	}
+	if streamed != 2 {
+		t.Errorf("Expected every host to be streamed, got %d", streamed)
+	}
+}
+
+// countingTransport is a Fake that counts Check calls
+type countingTransport struct {
+	*transport.Fake
+	checks atomic.Int32
+}
+
+func (c *countingTransport) Check(ctx context.Context, host string) bool {
+	c.checks.Add(1)
+	return c.Fake.Check(ctx, host)
+}
+
+func TestCheckAll_SkipsHostsAfterDeadline(t *testing.T) {
+	hosts := map[string]*transport.FakeHost{}
+	var names []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		hosts[name] = &transport.FakeHost{Delay: time.Second}
+		names = append(names, name)
+	}
+	counting := &countingTransport{Fake: transport.NewFake(hosts)}
+
+	start := time.Now()
+	results := CheckAll(context.Background(), counting, names, 5*time.Second, ProbeOptions{Workers: 1, Deadline: 50 * time.Millisecond}, nil)
+
+	// The first check gives up at the deadline and the rest never start
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected checks to stop at the deadline, took %s", elapsed)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := counting.checks.Load(); got != 1 {
+		t.Errorf("Expected only the first host checked, got %d checks", got)
+	}
+	for _, r := range results {
+		if r.Reachable {
+			t.Errorf("Expected %s unreachable past the deadline", r.Host)
+		}
+	}
+}
+
+func TestCheckAll_BoundedWorkers(t *testing.T) {
+	hosts := map[string]*transport.FakeHost{}
+	var names []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		hosts[name] = &transport.FakeHost{Delay: 100 * time.Millisecond}
+		names = append(names, name)
+	}
+
+	start := time.Now()
+	results := CheckAll(context.Background(), transport.NewFake(hosts), names, time.Second, ProbeOptions{Workers: 2}, nil)
+	elapsed := time.Since(start)
+
+	// Two workers over four hosts need two rounds
+	if elapsed < 200*time.Millisecond {
+		t.Errorf("Expected worker limit to serialize rounds, took %s", elapsed)
+	}
+
+	for _, r := range results {
+		if !r.Reachable {
+			t.Errorf("Expected %s reachable", r.Host)
+		}
+	}
+}
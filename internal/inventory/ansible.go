@@ -0,0 +1,398 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/config"
+)
+
+// ScriptTimeout bounds how long a dynamic inventory script may run
+const ScriptTimeout = 30 * time.Second
+
+// Ansible variables that say how to reach a host. The ansible_ssh_ forms
+// are the older spelling of the same settings.
+var (
+	addressVars = []string{"ansible_host", "ansible_ssh_host"}
+	userVars    = []string{"ansible_user", "ansible_ssh_user"}
+	portVars    = []string{"ansible_port", "ansible_ssh_port"}
+)
+
+// ansible is an inventory in Ansible's model: groups of hosts with
+// variables, where groups can contain other groups
+type ansible struct {
+	// hosts lists host names in order of first appearance
+	hosts    []string
+	hostVars map[string]map[string]string
+	groups   map[string]*ansibleGroup
+}
+
+type ansibleGroup struct {
+	hosts    []string
+	children []string
+	vars     map[string]string
+}
+
+func newAnsible() *ansible {
+	return &ansible{hostVars: make(map[string]map[string]string), groups: make(map[string]*ansibleGroup)}
+}
+
+func (a *ansible) group(name string) *ansibleGroup {
+	g, ok := a.groups[name]
+	if !ok {
+		g = &ansibleGroup{vars: make(map[string]string)}
+		a.groups[name] = g
+	}
+	return g
+}
+
+// addHost records a host with its variables, later ones overriding
+func (a *ansible) addHost(name string, vars map[string]string) {
+	if _, ok := a.hostVars[name]; !ok {
+		a.hosts = append(a.hosts, name)
+		a.hostVars[name] = make(map[string]string)
+	}
+	maps.Copy(a.hostVars[name], vars)
+}
+
+// members returns every host in a group and, recursively, its children.
+// A group that contains itself through its children is only walked once.
+func (a *ansible) members(name string, seen map[string]bool) []string {
+	if seen[name] {
+		return nil
+	}
+	seen[name] = true
+
+	g, ok := a.groups[name]
+	if !ok {
+		return nil
+	}
+	hosts := slices.Clone(g.hosts)
+	for _, child := range g.children {
+		for _, h := range a.members(child, seen) {
+			if !slices.Contains(hosts, h) {
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	return hosts
+}
+
+// view resolves groups to their hosts and variables to addresses and
+// labels. Group variables apply to every member, with host variables
+// taking precedence.
+func (a *ansible) view(source string) *View {
+	v := &View{Groups: make(map[string][]string)}
+	vars := make(map[string]map[string]string)
+
+	// Apply group variables in name order so the result is stable when
+	// groups disagree
+	for _, name := range slices.Sorted(maps.Keys(a.groups)) {
+		members := a.members(name, make(map[string]bool))
+		v.Groups[name] = members
+		for _, h := range members {
+			if vars[h] == nil {
+				vars[h] = make(map[string]string)
+			}
+			maps.Copy(vars[h], a.groups[name].vars)
+		}
+	}
+
+	for _, name := range a.hosts {
+		hv := vars[name]
+		if hv == nil {
+			hv = make(map[string]string)
+		}
+		maps.Copy(hv, a.hostVars[name])
+
+		h := &Host{Name: name, Sources: []string{source}}
+		for key, value := range hv {
+			switch {
+			case slices.Contains(addressVars, key):
+				h.Address = value
+			case slices.Contains(userVars, key):
+				h.User = value
+			case slices.Contains(portVars, key):
+				h.Port = value
+			case strings.HasPrefix(key, "ansible_") || !config.ValidLabelName(key):
+				// Other connection settings don't apply to dw
+			default:
+				if h.Labels == nil {
+					h.Labels = make(map[string]string)
+				}
+				h.Labels[key] = value
+			}
+		}
+		v.Hosts = append(v.Hosts, h)
+	}
+
+	return v
+}
+
+// INI is an Ansible-style INI inventory file:
+//
+//	[build]
+//	homelab ansible_host=100.72.192.70 ansible_user=wv3 gpu=true
+//	build-2 ansible_port=2222
+//
+//	[build:vars]
+//	docker=true
+//
+//	[linux:children]
+//	build
+//
+// Variables other than ansible_* become labels.
+type INI struct {
+	Path string
+}
+
+// Name returns the file path
+func (i INI) Name() string {
+	return i.Path
+}
+
+// Load parses the file
+func (i INI) Load(ctx context.Context) (*View, error) {
+	data, err := os.ReadFile(i.Path)
+	if err != nil {
+		return nil, err
+	}
+	a, err := parseINI(data)
+	if err != nil {
+		return nil, err
+	}
+	return a.view(i.Name()), nil
+}
+
+// parseINI reads an Ansible INI inventory. Hosts before the first section
+// belong to the ungrouped group.
+func parseINI(data []byte) (*ansible, error) {
+	a := newAnsible()
+	section, kind := "ungrouped", "hosts"
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section %q", n, line)
+			}
+			section, kind, _ = strings.Cut(strings.Trim(line, "[]"), ":")
+			if kind == "" {
+				kind = "hosts"
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: unknown section type %q", n, kind)
+			}
+			a.group(section)
+			continue
+		}
+
+		fields, err := splitFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		g := a.group(section)
+		switch kind {
+		case "hosts":
+			vars, err := parseVars(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			a.addHost(fields[0], vars)
+			if !slices.Contains(g.hosts, fields[0]) {
+				g.hosts = append(g.hosts, fields[0])
+			}
+		case "vars":
+			vars, err := parseVars(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			maps.Copy(g.vars, vars)
+		case "children":
+			g.children = append(g.children, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Drop the implicit group if nothing landed in it
+	if g := a.groups["ungrouped"]; g != nil && len(g.hosts) == 0 && len(g.children) == 0 {
+		delete(a.groups, "ungrouped")
+	}
+	return a, nil
+}
+
+// splitFields splits a line on whitespace, keeping quoted values such as
+// desc="two words" together and dropping trailing # comments
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var current strings.Builder
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && current.Len() == 0:
+			return fields, nil
+		case r == ' ' || r == '\t':
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields, nil
+}
+
+// parseVars reads key=value fields
+func parseVars(fields []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, f := range fields {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", f)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// Script is an executable dynamic inventory. Like Ansible, dw runs it
+// with --list and reads JSON from its stdout:
+//
+//	{
+//	  "build": {"hosts": ["homelab"], "vars": {"docker": "true"}, "children": ["gpu"]},
+//	  "gpu": ["build-2"],
+//	  "_meta": {"hostvars": {"homelab": {"ansible_host": "100.72.192.70"}}}
+//	}
+type Script struct {
+	Path string
+}
+
+// Name returns the script path
+func (s Script) Name() string {
+	return s.Path
+}
+
+// Load runs the script and parses its output
+func (s Script) Load(ctx context.Context) (*View, error) {
+	ctx, cancel := context.WithTimeout(ctx, ScriptTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.Path, "--list")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	a, err := parseJSON(out)
+	if err != nil {
+		return nil, err
+	}
+	return a.view(s.Name()), nil
+}
+
+// parseJSON reads Ansible's dynamic inventory format. A group is either
+// a list of hosts or an object with hosts, vars and children; host
+// variables live under _meta.hostvars.
+func parseJSON(data []byte) (*ansible, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid inventory JSON: %w", err)
+	}
+
+	a := newAnsible()
+	if meta, ok := raw["_meta"]; ok {
+		var m struct {
+			HostVars map[string]map[string]any `json:"hostvars"`
+		}
+		if err := json.Unmarshal(meta, &m); err != nil {
+			return nil, fmt.Errorf("invalid _meta: %w", err)
+		}
+		for _, name := range slices.Sorted(maps.Keys(m.HostVars)) {
+			a.addHost(name, stringVars(m.HostVars[name]))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(raw)) {
+		if name == "_meta" {
+			continue
+		}
+
+		var entry struct {
+			Hosts    []string       `json:"hosts"`
+			Vars     map[string]any `json:"vars"`
+			Children []string       `json:"children"`
+		}
+		if err := json.Unmarshal(raw[name], &entry.Hosts); err != nil {
+			entry.Hosts = nil
+			if err := json.Unmarshal(raw[name], &entry); err != nil {
+				return nil, fmt.Errorf("invalid group %q: %w", name, err)
+			}
+		}
+
+		g := a.group(name)
+		for _, h := range entry.Hosts {
+			a.addHost(h, nil)
+			if !slices.Contains(g.hosts, h) {
+				g.hosts = append(g.hosts, h)
+			}
+		}
+		g.children = append(g.children, entry.Children...)
+		maps.Copy(g.vars, stringVars(entry.Vars))
+	}
+
+	return a, nil
+}
+
+// stringVars formats JSON variable values as label strings
+func stringVars(vars map[string]any) map[string]string {
+	out := make(map[string]string, len(vars))
+	for key, value := range vars {
+		switch v := value.(type) {
+		case string:
+			out[key] = v
+		case float64, bool:
+			out[key] = fmt.Sprint(v)
+		}
+		// Lists and objects have no label form
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package inventory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestINI(t *testing.T) {
+	v, err := INI{Path: "testdata/hosts.ini"}.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	wantGroups := map[string][]string{
+		"ungrouped":    {"homelab"},
+		"build":        {"build-1", "build-2"},
+		"workstations": {"sonia-mac"},
+		"linux":        {"build-1", "build-2", "homelab"},
+	}
+	if !reflect.DeepEqual(v.Groups, wantGroups) {
+		t.Errorf("Expected groups %v, got %v", wantGroups, v.Groups)
+	}
+
+	tests := []Host{
+		{Name: "homelab", Address: "100.72.192.70", User: "wv3"},
+		{Name: "build-1", Address: "10.0.0.11", User: "ci", Port: "2222", Labels: map[string]string{"docker": "true", "gpu": "true"}},
+		{Name: "build-2", Address: "10.0.0.12", User: "ci", Labels: map[string]string{"docker": "true", "desc": "spare box"}},
+		{Name: "sonia-mac"},
+	}
+	for _, want := range tests {
+		h, ok := v.Host(want.Name)
+		if !ok {
+			t.Errorf("Expected host %s", want.Name)
+			continue
+		}
+		if h.Address != want.Address || h.User != want.User || h.Port != want.Port || !reflect.DeepEqual(h.Labels, want.Labels) {
+			t.Errorf("Host %s = %+v, want %+v", want.Name, h, want)
+		}
+		if !reflect.DeepEqual(h.Sources, []string{"testdata/hosts.ini"}) {
+			t.Errorf("Host %s: unexpected sources %v", want.Name, h.Sources)
+		}
+	}
+}
+
+func TestParseINI_Invalid(t *testing.T) {
+	tests := []string{
+		"[build\nhomelab\n",
+		"[build:weird]\nhomelab\n",
+		"homelab ansible_host\n",
+		"homelab desc=\"open\n",
+	}
+	for _, data := range tests {
+		if _, err := parseINI([]byte(data)); err == nil {
+			t.Errorf("Expected error for %q", data)
+		}
+	}
+}
+
+func TestParseINI_ChildCycle(t *testing.T) {
+	a, err := parseINI([]byte("[a]\nh1\n[a:children]\nb\n[b]\nh2\n[b:children]\na\n"))
+	if err != nil {
+		t.Fatalf("parseINI failed: %v", err)
+	}
+
+	v := a.view("test")
+	if want := []string{"h1", "h2"}; !reflect.DeepEqual(v.Groups["a"], want) {
+		t.Errorf("Expected group a %v, got %v", want, v.Groups["a"])
+	}
+	if want := []string{"h2", "h1"}; !reflect.DeepEqual(v.Groups["b"], want) {
+		t.Errorf("Expected group b %v, got %v", want, v.Groups["b"])
+	}
+}
+
+func TestScript(t *testing.T) {
+	v, err := Script{Path: "testdata/inventory.sh"}.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	wantGroups := map[string][]string{
+		"build": {"build-3", "build-4"},
+		"gpu":   {"build-4"},
+	}
+	if !reflect.DeepEqual(v.Groups, wantGroups) {
+		t.Errorf("Expected groups %v, got %v", wantGroups, v.Groups)
+	}
+
+	h, ok := v.Host("build-3")
+	if !ok {
+		t.Fatal("Expected host build-3")
+	}
+	want := &Host{
+		Name: "build-3", Address: "10.0.0.13", User: "ci", Port: "2200",
+		Labels:  map[string]string{"docker": "true", "rack": "b2"},
+		Sources: []string{"testdata/inventory.sh"},
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("build-3 = %+v, want %+v", h, want)
+	}
+}
+
+func TestScript_Fails(t *testing.T) {
+	if _, err := (Script{Path: "testdata/hosts.ini"}).Load(context.Background()); err == nil {
+		t.Error("Expected error running a non-executable script")
+	}
+	if _, err := parseJSON([]byte(`{"build": 42}`)); err == nil {
+		t.Error("Expected error for a malformed group")
+	}
+}
@@ -0,0 +1,246 @@
+// Package inventory merges the hosts and groups dw knows about from
+// ~/.ssh/config, config.yaml and external inventories into one view
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+
+	"github.com/WillyV3/distributed/internal/config"
+)
+
+// SSHConfigSource names ~/.ssh/config in Host.Sources
+const SSHConfigSource = "ssh config"
+
+// Host is a machine listed by at least one inventory
+type Host struct {
+	Name    string            `json:"name" yaml:"name"`
+	Address string            `json:"address,omitempty" yaml:"address,omitempty"`
+	User    string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Port    string            `json:"port,omitempty" yaml:"port,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Sources names every inventory that lists the host
+	Sources []string `json:"sources" yaml:"sources"`
+
+	// overridden is set once a source other than ~/.ssh/config sets the
+	// address, user or port
+	overridden bool
+}
+
+// Overridden reports whether an inventory other than ~/.ssh/config says
+// how to reach the host. Otherwise ssh already knows.
+func (h *Host) Overridden() bool {
+	return h.overridden
+}
+
+// View is the hosts and groups of one or more inventories
+type View struct {
+	Hosts  []*Host             `json:"hosts" yaml:"hosts"`
+	Groups map[string][]string `json:"groups" yaml:"groups"`
+}
+
+// Host returns the host with the given name
+func (v *View) Host(name string) (*Host, bool) {
+	for _, h := range v.Hosts {
+		if h.Name == name {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// Group returns the hosts in a group, expanding references to other
+// groups, globs and exclusions
+func (v *View) Group(name string) ([]string, error) {
+	return v.resolver(nil).Group(name)
+}
+
+// Resolve returns the hosts selected by a --group expression such as
+// "dev,!laptop". external resolves terms the view doesn't know about, such
+// as tailscale: groups, and may be nil.
+func (v *View) Resolve(expr string, external func(term string) ([]string, bool, error)) ([]string, error) {
+	return v.resolver(external).Expression(expr)
+}
+
+func (v *View) resolver(external func(string) ([]string, bool, error)) *config.GroupResolver {
+	names := make([]string, len(v.Hosts))
+	for i, h := range v.Hosts {
+		names[i] = h.Name
+	}
+	return &config.GroupResolver{Groups: v.Groups, Hosts: names, External: external}
+}
+
+// Labels returns the labels of every host that has some
+func (v *View) Labels() map[string]map[string]string {
+	labels := make(map[string]map[string]string)
+	for _, h := range v.Hosts {
+		if len(h.Labels) > 0 {
+			labels[h.Name] = h.Labels
+		}
+	}
+	return labels
+}
+
+// Inventory is a source of hosts and groups
+type Inventory interface {
+	// Name identifies the source in Host.Sources and errors
+	Name() string
+	// Load reads the source's hosts and groups
+	Load(ctx context.Context) (*View, error)
+}
+
+// Merge combines views in order. A host listed by several views keeps its
+// first position; later views override its address, user and port where
+// they set them, and its labels one by one. Groups with the same name are
+// joined without duplicates.
+func Merge(views ...*View) *View {
+	merged := &View{Groups: make(map[string][]string)}
+	byName := make(map[string]*Host)
+
+	for _, v := range views {
+		for _, h := range v.Hosts {
+			m, ok := byName[h.Name]
+			if !ok {
+				m = &Host{Name: h.Name}
+				byName[h.Name] = m
+				merged.Hosts = append(merged.Hosts, m)
+			}
+
+			if h.overridden || (!slices.Equal(h.Sources, []string{SSHConfigSource}) && h.Address+h.User+h.Port != "") {
+				m.overridden = true
+			}
+			m.Address = override(m.Address, h.Address)
+			m.User = override(m.User, h.User)
+			m.Port = override(m.Port, h.Port)
+			if len(h.Labels) > 0 {
+				if m.Labels == nil {
+					m.Labels = make(map[string]string)
+				}
+				maps.Copy(m.Labels, h.Labels)
+			}
+			for _, source := range h.Sources {
+				if !slices.Contains(m.Sources, source) {
+					m.Sources = append(m.Sources, source)
+				}
+			}
+		}
+
+		for name, hosts := range v.Groups {
+			group := merged.Groups[name]
+			if group == nil {
+				group = []string{}
+			}
+			for _, h := range hosts {
+				if !slices.Contains(group, h) {
+					group = append(group, h)
+				}
+			}
+			merged.Groups[name] = group
+		}
+	}
+
+	return merged
+}
+
+// override returns value replaced by later unless later is empty
+func override(value, later string) string {
+	if later != "" {
+		return later
+	}
+	return value
+}
+
+// Sources returns every inventory cfg uses, lowest precedence first:
+// ~/.ssh/config, then the configured INI files and scripts, then the
+// hosts and groups in config.yaml itself
+func Sources(cfg *config.Config) []Inventory {
+	sources := []Inventory{SSHConfig{}}
+	for _, s := range cfg.Inventory {
+		if s.INI != "" {
+			sources = append(sources, INI{Path: s.Path()})
+		} else {
+			sources = append(sources, Script{Path: s.Path()})
+		}
+	}
+	return append(sources, Static{Config: cfg})
+}
+
+// Load reads every source and merges them into one view
+func Load(ctx context.Context, sources []Inventory) (*View, error) {
+	views := make([]*View, 0, len(sources))
+	for _, s := range sources {
+		v, err := s.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("inventory %s: %w", s.Name(), err)
+		}
+		views = append(views, v)
+	}
+	return Merge(views...), nil
+}
+
+// SSHConfig lists every concrete Host alias in ~/.ssh/config. It
+// defines no groups.
+type SSHConfig struct{}
+
+// Name returns "ssh config"
+func (SSHConfig) Name() string {
+	return SSHConfigSource
+}
+
+// Load parses ~/.ssh/config. A missing file is an empty inventory.
+func (SSHConfig) Load(ctx context.Context) (*View, error) {
+	hosts, err := config.ParseSSHConfig()
+	if errors.Is(err, fs.ErrNotExist) {
+		return &View{Groups: map[string][]string{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v := &View{Groups: map[string][]string{}}
+	for _, h := range hosts {
+		v.Hosts = append(v.Hosts, &Host{
+			Name:    h.Alias,
+			Address: h.Hostname,
+			User:    h.User,
+			Port:    h.Port,
+			Sources: []string{SSHConfigSource},
+		})
+	}
+	return v, nil
+}
+
+// Static is the hosts and groups written in config.yaml
+type Static struct {
+	Config *config.Config
+}
+
+// Name returns "config"
+func (Static) Name() string {
+	return "config"
+}
+
+// Load lists the hosts under hosts:, ordered by name since YAML maps carry
+// no order, and the groups as written
+func (s Static) Load(ctx context.Context) (*View, error) {
+	v := &View{Groups: make(map[string][]string)}
+	for _, name := range slices.Sorted(maps.Keys(s.Config.Hosts)) {
+		h := s.Config.Hosts[name]
+		v.Hosts = append(v.Hosts, &Host{
+			Name:    name,
+			Address: h.Address,
+			User:    h.User,
+			Port:    h.Port,
+			Labels:  maps.Clone(h.Labels),
+			Sources: []string{s.Name()},
+		})
+	}
+	for name, hosts := range s.Config.Groups {
+		v.Groups[name] = slices.Clone(hosts)
+	}
+	return v, nil
+}
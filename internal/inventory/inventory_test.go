@@ -0,0 +1,163 @@
+package inventory
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/WillyV3/distributed/internal/config"
+)
+
+func TestMerge(t *testing.T) {
+	ssh := &View{Hosts: []*Host{
+		{Name: "homelab", Address: "100.72.192.70", User: "wv3", Sources: []string{SSHConfigSource}},
+		{Name: "sonia-mac", Address: "100.72.192.80", Sources: []string{SSHConfigSource}},
+	}}
+	ini := &View{
+		Hosts: []*Host{
+			{Name: "homelab", User: "ci", Labels: map[string]string{"docker": "true", "rack": "a1"}, Sources: []string{"hosts.ini"}},
+			{Name: "build-1", Address: "10.0.0.11", Sources: []string{"hosts.ini"}},
+		},
+		Groups: map[string][]string{"build": {"homelab", "build-1"}},
+	}
+	static := &View{
+		Hosts:  []*Host{{Name: "homelab", Labels: map[string]string{"rack": "b2"}, Sources: []string{"config"}}},
+		Groups: map[string][]string{"build": {"build-1", "build-2"}, "dev": {}},
+	}
+
+	v := Merge(ssh, ini, static)
+
+	var names []string
+	for _, h := range v.Hosts {
+		names = append(names, h.Name)
+	}
+	if want := []string{"homelab", "sonia-mac", "build-1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected hosts %v, got %v", want, names)
+	}
+
+	h, _ := v.Host("homelab")
+	if h.Address != "100.72.192.70" || h.User != "ci" {
+		t.Errorf("Expected later sources to override set fields only, got %+v", h)
+	}
+	if want := map[string]string{"docker": "true", "rack": "b2"}; !reflect.DeepEqual(h.Labels, want) {
+		t.Errorf("Expected labels %v, got %v", want, h.Labels)
+	}
+	if want := []string{SSHConfigSource, "hosts.ini", "config"}; !reflect.DeepEqual(h.Sources, want) {
+		t.Errorf("Expected sources %v, got %v", want, h.Sources)
+	}
+
+	wantGroups := map[string][]string{"build": {"homelab", "build-1", "build-2"}, "dev": {}}
+	if !reflect.DeepEqual(v.Groups, wantGroups) {
+		t.Errorf("Expected groups %v, got %v", wantGroups, v.Groups)
+	}
+
+	tests := map[string]bool{"homelab": true, "sonia-mac": false, "build-1": true}
+	for name, want := range tests {
+		if h, _ := v.Host(name); h.Overridden() != want {
+			t.Errorf("%s: Overridden() = %v, want %v", name, h.Overridden(), want)
+		}
+	}
+}
+
+func TestView_Resolve(t *testing.T) {
+	v := &View{
+		Hosts: []*Host{{Name: "homelab"}, {Name: "build-1"}, {Name: "build-2"}, {Name: "laptop"}},
+		Groups: map[string][]string{
+			"dev":   {"@build", "laptop"},
+			"build": {"build-*"},
+		},
+	}
+
+	got, err := v.Group("dev")
+	if err != nil {
+		t.Fatalf("Group failed: %v", err)
+	}
+	if want := []string{"build-1", "build-2", "laptop"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	got, err = v.Resolve("dev,!laptop,homelab", nil)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := []string{"build-1", "build-2", "homelab"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	sshConfig := "Host homelab\n    HostName homelab.local\n    User willy\n"
+	if err := os.WriteFile(filepath.Join(sshDir, "config"), []byte(sshConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Groups: map[string][]string{"dev": {"homelab", "pi"}},
+		Hosts: map[string]config.Host{
+			"pi": {Address: "192.168.1.50", User: "pi", Labels: map[string]string{"arch": "arm64"}},
+		},
+		Inventory: []config.InventorySource{{INI: "testdata/hosts.ini"}, {Script: "testdata/inventory.sh"}},
+	}
+
+	v, err := Load(context.Background(), Sources(cfg))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if want := []string{"homelab", "pi"}; !reflect.DeepEqual(v.Groups["dev"], want) {
+		t.Errorf("Expected dev group %v, got %v", want, v.Groups["dev"])
+	}
+	for _, group := range []string{"build", "gpu", "linux", "workstations"} {
+		if _, err := v.Group(group); err != nil {
+			t.Errorf("Expected group %s from an inventory file: %v", group, err)
+		}
+	}
+	if _, err := v.Group("missing"); err == nil {
+		t.Error("Expected error for unknown group")
+	}
+
+	// ~/.ssh/config is read first, so the INI file's settings win
+	h, _ := v.Host("homelab")
+	if h.Address != "100.72.192.70" || h.User != "wv3" || !h.Overridden() {
+		t.Errorf("Unexpected homelab: %+v", h)
+	}
+	if want := []string{SSHConfigSource, "testdata/hosts.ini"}; !reflect.DeepEqual(h.Sources, want) {
+		t.Errorf("Expected sources %v, got %v", want, h.Sources)
+	}
+
+	if want := map[string]string{"arch": "arm64"}; !reflect.DeepEqual(v.Labels()["pi"], want) {
+		t.Errorf("Expected pi labels %v, got %v", want, v.Labels()["pi"])
+	}
+
+	cfg.Inventory = append(cfg.Inventory, config.InventorySource{INI: "testdata/missing.ini"})
+	if _, err := Load(context.Background(), Sources(cfg)); err == nil {
+		t.Error("Expected error for a missing inventory file")
+	}
+}
+
+func TestLoad_NoSSHConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cfg := &config.Config{
+		Groups: map[string][]string{"dev": {"box"}},
+		Hosts:  map[string]config.Host{"box": {Address: "127.0.0.1"}},
+	}
+
+	v, err := Load(context.Background(), Sources(cfg))
+	if err != nil {
+		t.Fatalf("Expected a missing ~/.ssh/config to be an empty inventory, got %v", err)
+	}
+	h, ok := v.Host("box")
+	if !ok || h.Address != "127.0.0.1" || !h.Overridden() {
+		t.Errorf("Expected box from config.yaml, got %+v", h)
+	}
+}
@@ -0,0 +1,12 @@
+#!/bin/sh
+[ "$1" = "--list" ] || { echo "usage: $0 --list" >&2; exit 2; }
+cat <<'JSON'
+{
+  "build": {"hosts": ["build-3"], "vars": {"docker": true, "ansible_user": "ci"}, "children": ["gpu"]},
+  "gpu": ["build-4"],
+  "_meta": {"hostvars": {
+    "build-3": {"ansible_host": "10.0.0.13", "ansible_port": 2200, "rack": "b2", "tags": ["x"]},
+    "build-4": {"ansible_host": "10.0.0.14"}
+  }}
+}
+JSON
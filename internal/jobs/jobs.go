@@ -0,0 +1,154 @@
+// Package jobs keeps track of commands submitted to run detached on
+// remote hosts
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/remote"
+)
+
+// Job is a detached command running, or once run, on a remote host
+type Job struct {
+	ID        string    `json:"id" yaml:"id"`
+	Host      string    `json:"host" yaml:"host"`
+	Command   string    `json:"command" yaml:"command"`
+	Dir       string    `json:"dir,omitempty" yaml:"dir,omitempty"`
+	PID       int       `json:"pid" yaml:"pid"`
+	Log       string    `json:"log" yaml:"log"`
+	Submitted time.Time `json:"submitted" yaml:"submitted"`
+}
+
+// New returns a job for command on host with a fresh id and the remote
+// path its log will be written to
+func New(host, command, dir string) Job {
+	id := remote.NewID()
+	return Job{
+		ID:        id,
+		Host:      host,
+		Command:   command,
+		Dir:       dir,
+		Log:       "~/" + remote.LogDir + "/" + id + ".log",
+		Submitted: time.Now(),
+	}
+}
+
+// ShortID is the abbreviated id shown in listings
+func (j Job) ShortID() string {
+	return j.ID[:min(len(j.ID), 8)]
+}
+
+// StatePath returns the path to the local job state file
+func StatePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "distributed", "jobs.json"), nil
+}
+
+// Load reads the submitted jobs, oldest first. A missing state file
+// means no jobs.
+func Load() ([]Job, error) {
+	path, err := StatePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("invalid job state %s: %w", path, err)
+	}
+	return jobs, nil
+}
+
+// Update applies change to the submitted jobs and saves the result. The
+// state file stays locked from load to save, so jobs recorded by other
+// dw processes meanwhile are not lost.
+func Update(change func([]Job) []Job) error {
+	path, err := StatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(filepath.Join(filepath.Dir(path), "jobs.lock"))
+	if err != nil {
+		return fmt.Errorf("failed to lock job state: %w", err)
+	}
+	defer unlock()
+
+	jobs, err := Load()
+	if err != nil {
+		return err
+	}
+	return save(path, change(jobs))
+}
+
+// save writes jobs to path
+func save(path string, jobs []Job) error {
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Replace the file in one step so a crash never leaves it half written
+	tmp, err := os.CreateTemp(filepath.Dir(path), "jobs-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Add records a newly submitted job
+func Add(job Job) error {
+	return Update(func(jobs []Job) []Job {
+		return append(jobs, job)
+	})
+}
+
+// Find returns the job whose id starts with prefix
+func Find(jobs []Job, prefix string) (Job, error) {
+	var matches []Job
+	for _, job := range jobs {
+		if strings.HasPrefix(job.ID, prefix) {
+			matches = append(matches, job)
+		}
+	}
+
+	switch {
+	case prefix == "" || len(matches) == 0:
+		return Job{}, fmt.Errorf("no job %q", prefix)
+	case len(matches) > 1:
+		return Job{}, fmt.Errorf("job id %q is ambiguous: matches %d jobs", prefix, len(matches))
+	}
+	return matches[0], nil
+}
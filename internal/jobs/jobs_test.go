@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	job := New("homelab", "make", "~/projects/app")
+
+	if len(job.ID) != 16 || job.ShortID() != job.ID[:8] {
+		t.Errorf("ID = %q, ShortID = %q", job.ID, job.ShortID())
+	}
+	if want := "~/.dw/logs/" + job.ID + ".log"; job.Log != want {
+		t.Errorf("Log = %q, want %q", job.Log, want)
+	}
+	if job.Submitted.IsZero() {
+		t.Error("Submitted not set")
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	jobs, err := Load()
+	if err != nil || len(jobs) != 0 {
+		t.Fatalf("Load() without state = %v, %v; want no jobs", jobs, err)
+	}
+
+	first := New("h1", "make", "")
+	second := New("h2", "go test ./...", "~/app")
+	second.PID = 42
+	if err := Add(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(second); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != first.ID || jobs[1].PID != 42 || jobs[1].Dir != "~/app" {
+		t.Errorf("Load() = %+v", jobs)
+	}
+	if !jobs[1].Submitted.Equal(second.Submitted) {
+		t.Errorf("Submitted = %v, want %v", jobs[1].Submitted, second.Submitted)
+	}
+}
+
+func TestFind(t *testing.T) {
+	jobs := []Job{
+		{ID: "abc123", Host: "h1"},
+		{ID: "abd456", Host: "h2"},
+	}
+
+	tests := []struct {
+		prefix  string
+		want    string
+		wantErr string
+	}{
+		{prefix: "abc", want: "abc123"},
+		{prefix: "abd456", want: "abd456"},
+		{prefix: "ab", wantErr: "ambiguous"},
+		{prefix: "zz", wantErr: "no job"},
+		{prefix: "", wantErr: "no job"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			job, err := Find(jobs, tt.prefix)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Find(%q) error = %v, want %q", tt.prefix, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || job.ID != tt.want {
+				t.Errorf("Find(%q) = %v, %v; want %s", tt.prefix, job.ID, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdd_Concurrent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- Add(New(fmt.Sprintf("h%d", i), "make", ""))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	jobs, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != n {
+		t.Errorf("Expected %d jobs recorded, got %d", n, len(jobs))
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package jobs
+
+// lockFile does nothing where flock is not available
+func lockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,47 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, valid := range []string{"table", "json", "yaml"} {
+		if _, err := ParseFormat(valid); err != nil {
+			t.Errorf("ParseFormat(%q) failed: %v", valid, err)
+		}
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	doc := struct {
+		Host      string `json:"host" yaml:"host"`
+		Reachable bool   `json:"reachable" yaml:"reachable"`
+	}{"homelab", true}
+
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{JSON, "{\n  \"host\": \"homelab\",\n  \"reachable\": true\n}\n"},
+		{YAML, "host: homelab\nreachable: true\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Write(&buf, tt.format, doc); err != nil {
+			t.Fatalf("Write(%s) failed: %v", tt.format, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("Write(%s) = %q, want %q", tt.format, buf.String(), tt.want)
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, Table, doc); err == nil {
+		t.Error("Expected error writing table format")
+	}
+}
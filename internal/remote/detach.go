@@ -0,0 +1,103 @@
+package remote
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LogDir is where detached jobs write their output and exit status on the
+// remote host, relative to the remote user's home directory: <id>.log
+// and <id>.exit.
+const LogDir = ".dw/logs"
+
+// Detach returns a remote command line that starts command as the
+// tracked dw job id in the background and prints its pid. The job is
+// moved to its own session where setsid is available, so it survives the
+// connection and can still be stopped as a group with Stop.
+func Detach(id, command string) string {
+	// The outer shell outlives an INT or TERM to record the exit status;
+	// a KILL leaves no status behind
+	inner := "trap : INT TERM; " + Wrap(id, command) + `; echo $? > "$HOME/` + LogDir + `/` + id + `.exit"`
+
+	return `d="$HOME/` + LogDir + `"; mkdir -p "$d"; ` +
+		`s=; command -v setsid >/dev/null 2>&1 && s=setsid; ` +
+		`nohup $s sh -c ` + Quote(inner) + ` > "$d/"` + Quote(id+".log") + ` 2>&1 < /dev/null & p=$!; ` +
+		// Wait for the job to register so its status is known right away
+		`f="$HOME/` + JobDir + `/"` + Quote(id) + `; e="$d/"` + Quote(id+".exit") + `; i=0; ` +
+		`while [ ! -f "$f" ] && [ ! -f "$e" ] && [ $i -lt 50 ]; do sleep 0.1; i=$((i + 1)); done; echo $p`
+}
+
+// Logs returns a remote command line that prints the output of job id.
+// With follow it keeps printing new output until the job exits.
+func Logs(id string, follow bool) string {
+	log := `"$HOME/` + LogDir + `/"` + Quote(id+".log")
+	if !follow {
+		return `cat ` + log
+	}
+	return `f="$HOME/` + JobDir + `/"` + Quote(id) + `; ` +
+		`tail -n +1 -f ` + log + ` & t=$!; ` +
+		`while [ -f "$f" ]; do sleep 1; done; sleep 1; kill $t 2>/dev/null; wait $t 2>/dev/null; exit 0`
+}
+
+// JobStatus is the state of a detached job as reported by Status
+type JobStatus struct {
+	Running bool
+	// Exited is set once the job has finished and left an exit status
+	Exited   bool
+	ExitCode int
+}
+
+// String describes the status, e.g. "running" or "exit 1"
+func (s JobStatus) String() string {
+	switch {
+	case s.Running:
+		return "running"
+	case s.Exited:
+		return "exit " + strconv.Itoa(s.ExitCode)
+	default:
+		return "unknown"
+	}
+}
+
+// Status returns a remote command line that reports the state of each
+// job in ids, one "<id> running", "<id> exit <code>" or "<id> unknown"
+// line per job. Jobs that were killed or whose logs were removed are
+// unknown.
+func Status(ids ...string) string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = Quote(id)
+	}
+	return `for id in ` + strings.Join(quoted, " ") + `; do ` +
+		`f="$HOME/` + JobDir + `/$id"; e="$HOME/` + LogDir + `/$id.exit"; ` +
+		`if [ -f "$f" ] && read pid < "$f" && kill -0 "$pid" 2>/dev/null; then echo "$id running"; ` +
+		`elif [ -s "$e" ]; then echo "$id exit $(cat "$e")"; ` +
+		`else echo "$id unknown"; fi; done`
+}
+
+// ParseStatus reads the output of Status into a status per job id
+func ParseStatus(output string) map[string]JobStatus {
+	statuses := make(map[string]JobStatus)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		id := fields[0]
+		switch fields[1] {
+		case "running":
+			statuses[id] = JobStatus{Running: true}
+		case "exit":
+			if len(fields) < 3 {
+				continue
+			}
+			if code, err := strconv.Atoi(fields[2]); err == nil {
+				statuses[id] = JobStatus{Exited: true, ExitCode: code}
+			}
+		default:
+			statuses[id] = JobStatus{}
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,101 @@
+package remote
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// shell runs a remote command line locally with HOME set to home
+func shell(t *testing.T, home, line string) string {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", line)
+	cmd.Env = append(os.Environ(), "HOME="+home, "SHELL=/bin/sh")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v running %s", err, line)
+	}
+	return string(out)
+}
+
+// waitStatus polls until job id reaches a status other than running
+func waitStatus(t *testing.T, home, id string) JobStatus {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		status := ParseStatus(shell(t, home, Status(id)))[id]
+		if !status.Running {
+			return status
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("job still running")
+	return JobStatus{}
+}
+
+func TestDetach(t *testing.T) {
+	home := t.TempDir()
+	id := NewID()
+
+	start := time.Now()
+	out := shell(t, home, Detach(id, `sleep 0.3; echo "it's done"; exit 4`))
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("Detach waited %s for the job", elapsed)
+	}
+	if _, err := strconv.Atoi(strings.TrimSpace(out)); err != nil {
+		t.Errorf("Detach printed %q, want a pid", out)
+	}
+
+	if got := ParseStatus(shell(t, home, Status(id)))[id]; !got.Running {
+		t.Errorf("status = %s right after submitting, want running", got)
+	}
+
+	// Following the log ends once the job does
+	if logs := shell(t, home, Logs(id, true)); !strings.Contains(logs, "it's done\n") {
+		t.Errorf("followed logs = %q", logs)
+	}
+
+	if got := waitStatus(t, home, id); got != (JobStatus{Exited: true, ExitCode: 4}) {
+		t.Errorf("status = %s, want exit 4", got)
+	}
+	if logs := shell(t, home, Logs(id, false)); logs != "it's done\n" {
+		t.Errorf("logs = %q", logs)
+	}
+}
+
+func TestDetach_Stop(t *testing.T) {
+	home := t.TempDir()
+	id := NewID()
+
+	shell(t, home, Detach(id, "sleep 30 & sleep 30"))
+	for i := 0; i < 100; i++ {
+		if ParseStatus(shell(t, home, Status(id)))[id].Running {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	shell(t, home, Stop(id, "TERM", time.Second))
+
+	got := waitStatus(t, home, id)
+	if !got.Exited || got.ExitCode == 0 {
+		t.Errorf("status = %s after stop, want a failed exit", got)
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	out := "a running\nb exit 0\nc exit 130\nd unknown\ne exit\n\n"
+
+	want := map[string]JobStatus{
+		"a": {Running: true},
+		"b": {Exited: true},
+		"c": {Exited: true, ExitCode: 130},
+		"d": {},
+	}
+	if got := ParseStatus(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseStatus() = %v, want %v", got, want)
+	}
+}
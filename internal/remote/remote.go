@@ -0,0 +1,98 @@
+package remote
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobDir is where wrapped commands record themselves on the remote host,
+// relative to the remote user's home directory. Each job is a file named
+// by its id holding the wrapper's pid, the job's process group and the
+// command, one per line.
+const JobDir = ".dw/jobs"
+
+// wrapper runs "$2" through the user's login shell, the same way ssh would,
+// while a file named "$1" under JobDir marks it as a running dw job. sshd
+// starts every session in its own process group, which is recorded so the
+// whole job can be signalled later. The wrapper itself only waits on
+// INT and TERM so it can clean up and exit with the command's status.
+const wrapper = `d="$HOME/` + JobDir + `"; f="$d/$1"; mkdir -p "$d"; ` +
+	`g=$(ps -o pgid= -p $$ 2>/dev/null | tr -d " "); [ -n "$g" ] || g=$$; ` +
+	`printf "%s\n%s\n%s\n" $$ "$g" "$2" > "$f"; ` +
+	`trap "rm -f \"$f\"" EXIT; trap : INT TERM; "${SHELL:-sh}" -c "$2"`
+
+// NewID returns a random id for a wrapped job
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Quote quotes s as a single POSIX shell word
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Wrap returns a remote command line that runs command as the tracked dw
+// job id
+func Wrap(id, command string) string {
+	return "sh -c " + Quote(wrapper) + " dw-job " + Quote(id) + " " + Quote(command)
+}
+
+// Stop returns a remote command line that stops the job id: sig (e.g.
+// "INT") is sent to every process of the job, and whatever is still
+// running after grace is killed. It succeeds when the job has already
+// exited.
+func Stop(id, sig string, grace time.Duration) string {
+	ticks := int(grace / (100 * time.Millisecond))
+	return `f="$HOME/` + JobDir + `"/` + Quote(id) + `; [ -f "$f" ] || exit 0; ` +
+		`{ read pid; read pgid; } < "$f"; ` +
+		`alive() { kill -0 -- -"$pgid" 2>/dev/null || kill -0 "$pid" 2>/dev/null; }; ` +
+		`kill -s ` + sig + ` -- -"$pgid" 2>/dev/null || kill -s ` + sig + ` "$pid" 2>/dev/null; ` +
+		`i=0; while alive && [ $i -lt ` + strconv.Itoa(ticks) + ` ]; do sleep 0.1; i=$((i + 1)); done; ` +
+		`alive && { kill -s KILL -- -"$pgid" 2>/dev/null || kill -s KILL "$pid" 2>/dev/null; }; ` +
+		`rm -f "$f"; exit 0`
+}
+
+// InDir returns a command line that runs command from dir on the remote
+// host, or nothing if dir can't be entered. A leading ~ is left unquoted
+// so the remote shell expands it.
+func InDir(dir, command string) string {
+	target := Quote(dir)
+	if dir == "~" {
+		target = "~"
+	} else if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		target = "~/" + Quote(rest)
+	}
+	return "cd " + target + " && " + Group(command)
+}
+
+// Group returns command as a single shell command, so lists such as
+// "make; make test" can follow && as a whole. The newline ends a trailing
+// comment or & in command.
+func Group(command string) string {
+	return "{ " + command + "\n}"
+}
+
+// AfterSetup returns a command line running each setup command in order
+// and then command, stopping at the first that fails
+func AfterSetup(setup []string, command string) string {
+	if len(setup) == 0 {
+		return command
+	}
+	steps := make([]string, 0, len(setup)+1)
+	for _, step := range setup {
+		steps = append(steps, Group(step))
+	}
+	return strings.Join(append(steps, Group(command)), " && ")
+}
+
+// CountJobs is a shell snippet that sets $jobs to the number of dw jobs
+// still running on the host
+const CountJobs = `jobs=0
+for f in "$HOME/` + JobDir + `"/*; do
+    [ -e "$f" ] && read pid < "$f" && kill -0 "$pid" 2>/dev/null && jobs=$((jobs + 1))
+done`
@@ -0,0 +1,180 @@
+package remote
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"go test ./...", `'go test ./...'`},
+		{"echo 'hi'", `'echo '\''hi'\'''`},
+		{"", `''`},
+	}
+
+	for _, tt := range tests {
+		if got := Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWrap_RunsCommandAndTracksJob(t *testing.T) {
+	home := t.TempDir()
+
+	// The wrapped command counts itself while it is running
+	command := `echo "it's running"; ` + CountJobs + `; echo "jobs=$jobs"; exit 3`
+
+	cmd := exec.Command("sh", "-c", Wrap(NewID(), command))
+	cmd.Env = append(os.Environ(), "HOME="+home, "SHELL=/bin/sh")
+	out, err := cmd.Output()
+
+	if code := cmd.ProcessState.ExitCode(); code != 3 {
+		t.Errorf("Expected exit code 3 to be preserved, got %d (err=%v)", code, err)
+	}
+
+	got := string(out)
+	if !strings.Contains(got, "it's running\n") {
+		t.Errorf("Expected quoted command output, got %q", got)
+	}
+	if !strings.Contains(got, "jobs=1\n") {
+		t.Errorf("Expected one running job, got %q", got)
+	}
+
+	// The job file is removed once the job exits
+	entries, _ := os.ReadDir(filepath.Join(home, JobDir))
+	if len(entries) != 0 {
+		t.Errorf("Expected job dir to be empty after exit, found %d entries", len(entries))
+	}
+}
+
+func TestInDir(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want string
+	}{
+		{"~/projects/myapp", "cd ~/'projects/myapp' && { go test ./...\n}"},
+		{"~", "cd ~ && { go test ./...\n}"},
+		{"/srv/my app", "cd '/srv/my app' && { go test ./...\n}"},
+	}
+
+	for _, tt := range tests {
+		if got := InDir(tt.dir, "go test ./..."); got != tt.want {
+			t.Errorf("InDir(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestInDir_GuardsWholeCommand(t *testing.T) {
+	dir := t.TempDir()
+	command := "echo one; false || echo two # done"
+
+	out, err := exec.Command("sh", "-c", InDir(filepath.Join(dir, "missing"), command)).Output()
+	if err == nil || len(out) != 0 {
+		t.Errorf("Expected nothing to run outside the directory, got %q, %v", out, err)
+	}
+
+	out, err = exec.Command("sh", "-c", InDir(dir, command)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "one\ntwo\n"; string(out) != want {
+		t.Errorf("Expected %q, got %q", want, out)
+	}
+}
+
+func TestAfterSetup(t *testing.T) {
+	command := "echo one; false || echo two"
+
+	if got := AfterSetup(nil, command); got != command {
+		t.Errorf("Expected the command unchanged without setup, got %q", got)
+	}
+
+	tests := []struct {
+		setup []string
+		want  string
+	}{
+		{[]string{"echo setup"}, "setup\none\ntwo\n"},
+		{[]string{"false", "echo setup"}, ""},
+		{[]string{"echo setup; false"}, "setup\n"},
+	}
+	for _, tt := range tests {
+		out, _ := exec.Command("sh", "-c", AfterSetup(tt.setup, command)).Output()
+		if string(out) != tt.want {
+			t.Errorf("AfterSetup(%q): got %q, want %q", tt.setup, out, tt.want)
+		}
+	}
+}
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+	}{
+		{"exits on signal", "sleep 30 & sleep 30; echo done"},
+		{"ignores signal", `trap "" INT; sleep 30`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			env := append(os.Environ(), "HOME="+home, "SHELL=/bin/sh")
+			id := NewID()
+
+			// sshd gives every session its own process group; do the same
+			// here so the signal stays inside the job
+			cmd := exec.Command("sh", "-c", Wrap(id, tt.command))
+			cmd.Env = env
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+			jobFile := filepath.Join(home, JobDir, id)
+			for i := 0; i < 100; i++ {
+				if data, err := os.ReadFile(jobFile); err == nil && strings.Count(string(data), "\n") >= 3 {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			start := time.Now()
+			stop := exec.Command("sh", "-c", Stop(id, "INT", 500*time.Millisecond))
+			stop.Env = env
+			if out, err := stop.CombinedOutput(); err != nil {
+				t.Fatalf("Stop failed: %v\n%s", err, out)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Stop took %s", elapsed)
+			}
+
+			if _, err := os.Stat(jobFile); !os.IsNotExist(err) {
+				t.Error("Expected job file to be removed")
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- cmd.Wait() }()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Job still running after Stop")
+			}
+
+			// Stopping a finished job is harmless
+			stop = exec.Command("sh", "-c", Stop(id, "INT", time.Second))
+			stop.Env = env
+			if err := stop.Run(); err != nil {
+				t.Errorf("Expected stopping a finished job to succeed, got %v", err)
+			}
+		})
+	}
+}
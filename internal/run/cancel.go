@@ -0,0 +1,121 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/remote"
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+// GracePeriod is how long a cancelled remote command has to exit after
+// being signalled before it is killed
+const GracePeriod = 5 * time.Second
+
+// disconnectWait is how long to wait for the connection to close on its
+// own once the remote command has been stopped
+var disconnectWait = 2 * time.Second
+
+// signalWait is how long to wait for ctx to be cancelled when the local
+// ssh was killed by a signal before dw's own handler ran
+var signalWait = 500 * time.Millisecond
+
+// stopTimeout bounds connecting to a host to stop a job, on top of the
+// grace period
+const stopTimeout = 10 * time.Second
+
+// Interrupt is the cancellation cause used when dw itself receives a
+// signal. The same signal is forwarded to remote commands.
+type Interrupt struct {
+	Signal os.Signal
+}
+
+func (i Interrupt) Error() string {
+	return "canceled by signal: " + i.Signal.String()
+}
+
+// runJob runs command on host as a tracked remote job. When ctx is
+// cancelled the job's whole process group is signalled on the remote
+// host, given GracePeriod to exit, and then killed.
+func runJob(ctx context.Context, t transport.Transport, host, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	id := remote.NewID()
+
+	// The connection outlives ctx so output keeps flowing while the
+	// remote command shuts down
+	conn, disconnect := context.WithCancel(context.WithoutCancel(ctx))
+	defer disconnect()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Run(conn, host, remote.Wrap(id, command), stdin, stdout, stderr)
+	}()
+
+	select {
+	case err := <-done:
+		if ctx.Err() == nil && transport.Killed(err) {
+			// The local ssh was hit by a signal, likely the Ctrl-C dw is
+			// still handling, so give that a moment to cancel ctx
+			select {
+			case <-ctx.Done():
+			case <-time.After(signalWait):
+			}
+		}
+		if ctx.Err() != nil {
+			// The local ssh may have been hit by the same Ctrl-C, which
+			// leaves the remote command running
+			stopJob(ctx, t, host, id)
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	stopJob(ctx, t, host, id)
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(disconnectWait):
+		disconnect()
+		return <-done
+	}
+}
+
+// stopJob stops a remote job with the signal matching why ctx was cancelled
+func stopJob(ctx context.Context, t transport.Transport, host, id string) {
+	// ctx is already done, so the stop gets its own bounded context
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), GracePeriod+stopTimeout)
+	defer cancel()
+
+	t.Output(stopCtx, host, remote.Stop(id, stopSignal(ctx), GracePeriod))
+}
+
+// stopSignal returns the signal to forward for a cancelled ctx. Timed
+// out commands get TERM, as timeout(1) would send.
+func stopSignal(ctx context.Context) string {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, context.DeadlineExceeded) {
+		return "TERM"
+	}
+
+	var interrupt Interrupt
+	if errors.As(cause, &interrupt) && interrupt.Signal == syscall.SIGTERM {
+		return "TERM"
+	}
+	return "INT"
+}
+
+// stopped reports whether ctx ended because it timed out or because it
+// was cancelled
+func stopped(ctx context.Context) (timedOut, canceled bool) {
+	if ctx.Err() == nil {
+		return false, false
+	}
+	if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		return true, false
+	}
+	return false, true
+}
@@ -0,0 +1,126 @@
+package run
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/WillyV3/distributed/internal/remote"
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+// Placeholder is replaced by the item in a Map command
+const Placeholder = "{}"
+
+// Worker is a host Map may send items to and how many it runs at once
+type Worker struct {
+	Host  string `json:"host" yaml:"host"`
+	Slots int    `json:"slots" yaml:"slots"`
+}
+
+// ItemResult is the outcome of one Map item
+type ItemResult struct {
+	// Seq is the item's 1-based position in the input
+	Seq    int    `json:"seq" yaml:"seq"`
+	Item   string `json:"item" yaml:"item"`
+	Result Result `json:"result" yaml:"result"`
+}
+
+// Expand returns command with every {} replaced by the shell-quoted item.
+// Without a {} the item is appended as the last argument, as xargs does.
+func Expand(command, item string) string {
+	if strings.Contains(command, Placeholder) {
+		return strings.ReplaceAll(command, Placeholder, remote.Quote(item))
+	}
+	return command + " " + remote.Quote(item)
+}
+
+// Map runs command once per item, handing the next item to whichever
+// worker slot frees up first, so faster hosts take more of the work.
+// wrap, if set, turns each expanded command into the command line run on
+// the host, e.g. adding setup and a cd, so {} is only looked for in
+// command itself.
+// Output is captured in each result and fn, if set, is called as each
+// item finishes, one at a time. A host whose connection fails gets no
+// more items, and the item it lost is retried once elsewhere. Results are
+// in items order; items never started, because ctx was done or every
+// host was lost, are returned as skipped.
+func Map(ctx context.Context, t transport.Transport, workers []Worker, command string, wrap func(string) string, items []string, fn func(ItemResult)) []ItemResult {
+	if wrap == nil {
+		wrap = func(command string) string { return command }
+	}
+
+	results := make([]ItemResult, len(items))
+	queue := make(chan int, len(items))
+	for i, item := range items {
+		results[i] = ItemResult{Seq: i + 1, Item: item, Result: Result{Skipped: true}}
+		queue <- i
+	}
+	if len(items) == 0 {
+		return results
+	}
+
+	var (
+		mu      sync.Mutex
+		retried = make([]bool, len(items))
+		pending atomic.Int64
+		wg      sync.WaitGroup
+	)
+	pending.Store(int64(len(items)))
+
+	// finish records an item's outcome; the last one releases every worker
+	finish := func(i int, r Result) {
+		mu.Lock()
+		if !r.Skipped {
+			results[i].Result = r
+			if fn != nil {
+				fn(results[i])
+			}
+		}
+		mu.Unlock()
+
+		if pending.Add(-1) == 0 {
+			close(queue)
+		}
+	}
+
+	for _, w := range workers {
+		var lost atomic.Bool
+		for range max(w.Slots, 1) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range queue {
+					if lost.Load() {
+						// Another slot found the host gone
+						queue <- i
+						return
+					}
+					if ctx.Err() != nil {
+						finish(i, Result{Host: w.Host, Skipped: true})
+						continue
+					}
+
+					r := runOne(ctx, t, w.Host, wrap(Expand(command, items[i])), Options{Capture: true}, nil)
+
+					if ctx.Err() == nil && Retryable(r.Err) {
+						lost.Store(true)
+						mu.Lock()
+						retry := !retried[i]
+						retried[i] = true
+						mu.Unlock()
+						if retry {
+							queue <- i
+							return
+						}
+					}
+					finish(i, r)
+				}
+			}()
+		}
+	}
+
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,160 @@
+package run
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/remote"
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		item    string
+		want    string
+	}{
+		{"placeholder", "gzip {}", "a.log", "gzip 'a.log'"},
+		{"several placeholders", "cp {} {}.bak", "a", "cp 'a' 'a'.bak"},
+		{"appended without placeholder", "curl -sO", "https://x/y", "curl -sO 'https://x/y'"},
+		{"item is quoted", "echo {}", "it's; rm -rf /", `echo 'it'\''s; rm -rf /'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Expand(tt.command, tt.item); got != tt.want {
+				t.Errorf("Expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// itemOf returns the item a wrapped Map command was run for
+func itemOf(command string) string {
+	_, item, _ := strings.Cut(command, "echo '\\''")
+	item, _, _ = strings.Cut(item, "'\\''")
+	return item
+}
+
+func TestMap(t *testing.T) {
+	echo := func(command string) (string, int) {
+		item := itemOf(command)
+		if item == "bad" {
+			return "", 1
+		}
+		return item + "\n", 0
+	}
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"h1": {Respond: echo},
+		"h2": {Respond: echo},
+	})
+
+	items := []string{"a", "b", "bad", "c"}
+	var seen []string
+	results := Map(context.Background(), fake, []Worker{{Host: "h1", Slots: 2}, {Host: "h2", Slots: 1}}, "echo {}", nil, items, func(r ItemResult) {
+		seen = append(seen, r.Item)
+	})
+
+	if len(seen) != len(items) {
+		t.Errorf("fn called for %v, want every item", seen)
+	}
+	for i, r := range results {
+		if r.Seq != i+1 || r.Item != items[i] {
+			t.Errorf("results[%d] = %d %q, want %d %q", i, r.Seq, r.Item, i+1, items[i])
+		}
+		if r.Item == "bad" {
+			if !r.Result.Failed() || r.Result.ExitCode != 1 {
+				t.Errorf("bad item result = %+v, want exit 1", r.Result)
+			}
+			continue
+		}
+		if r.Result.Failed() || r.Result.Stdout != r.Item+"\n" {
+			t.Errorf("item %q result = %+v, want its own output", r.Item, r.Result)
+		}
+	}
+}
+
+func TestMap_WrapAfterExpand(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{"h1": {}})
+
+	// {} in the wrapping is left alone, and the item is appended to the
+	// command rather than to the wrapping
+	wrap := func(command string) string {
+		return "find . -name x -exec true {} + && { " + command + "\n}"
+	}
+	Map(context.Background(), fake, []Worker{{Host: "h1", Slots: 1}}, "wc -l", wrap, []string{"a.txt"}, nil)
+
+	calls := fake.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected one command, got %v", calls)
+	}
+	want := remote.Quote("find . -name x -exec true {} + && { wc -l 'a.txt'\n}")
+	if !strings.Contains(calls[0].Command, want) {
+		t.Errorf("Expected %s in %s", want, calls[0].Command)
+	}
+}
+
+func TestMap_FasterHostTakesMore(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"fast": {Delay: 10 * time.Millisecond},
+		"slow": {Delay: 200 * time.Millisecond},
+	})
+
+	items := make([]string, 10)
+	for i := range items {
+		items[i] = "x"
+	}
+	results := Map(context.Background(), fake, []Worker{{Host: "slow", Slots: 1}, {Host: "fast", Slots: 1}}, "true", nil, items, nil)
+
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Result.Host]++
+	}
+	if counts["slow"] == 0 || counts["fast"] <= counts["slow"] {
+		t.Errorf("items per host = %v, want the fast host to take more", counts)
+	}
+}
+
+func TestMap_LostHost(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"up":   {},
+		"down": {Offline: true},
+	})
+
+	items := []string{"a", "b", "c", "d"}
+	results := Map(context.Background(), fake, []Worker{{Host: "down", Slots: 2}, {Host: "up", Slots: 1}}, "true", nil, items, nil)
+
+	for _, r := range results {
+		if r.Result.Failed() || r.Result.Skipped || r.Result.Host != "up" {
+			t.Errorf("item %q result = %+v, want it retried on the live host", r.Item, r.Result)
+		}
+	}
+
+	// With no host left, the remaining items are skipped
+	results = Map(context.Background(), fake, []Worker{{Host: "down", Slots: 1}}, "true", nil, items, nil)
+	for _, r := range results[1:] {
+		if !r.Result.Skipped {
+			t.Errorf("item %q result = %+v, want skipped", r.Item, r.Result)
+		}
+	}
+}
+
+func TestMap_Canceled(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{"h1": {}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := Map(ctx, fake, []Worker{{Host: "h1", Slots: 1}}, "true", nil, []string{"a", "b"}, nil)
+	for _, r := range results {
+		if !r.Result.Skipped {
+			t.Errorf("item %q result = %+v, want skipped", r.Item, r.Result)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("commands ran after cancel: %v", calls)
+	}
+}
@@ -0,0 +1,136 @@
+package run
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// colors are ANSI foreground colors assigned to hosts in order
+var colors = []string{
+	"\033[36m", // cyan
+	"\033[33m", // yellow
+	"\033[35m", // magenta
+	"\033[32m", // green
+	"\033[34m", // blue
+	"\033[91m", // bright red
+	"\033[96m", // bright cyan
+	"\033[93m", // bright yellow
+}
+
+const colorReset = "\033[0m"
+
+// Mux multiplexes output from several hosts onto shared writers.
+// Each host's output is line-buffered and prefixed with its name so
+// lines from different hosts never interleave mid-line.
+type Mux struct {
+	mu       sync.Mutex
+	stdout   io.Writer
+	stderr   io.Writer
+	group    bool
+	color    bool
+	prefixes map[string]string
+	colors   map[string]string
+}
+
+// NewMux creates a multiplexer for the given hosts.
+// When group is set, each host's output is held back and printed as a
+// single block by Block instead of streaming line by line.
+func NewMux(stdout, stderr io.Writer, hosts []string, group, color bool) *Mux {
+	m := &Mux{
+		stdout:   stdout,
+		stderr:   stderr,
+		group:    group,
+		color:    color,
+		prefixes: make(map[string]string),
+		colors:   make(map[string]string),
+	}
+
+	width := 0
+	for _, h := range hosts {
+		width = max(width, len(h))
+	}
+
+	for i, h := range hosts {
+		prefix := fmt.Sprintf("[%s]%s ", h, strings.Repeat(" ", width-len(h)))
+		if color {
+			m.colors[h] = colors[i%len(colors)]
+			prefix = m.colors[h] + prefix + colorReset
+		}
+		m.prefixes[h] = prefix
+	}
+
+	return m
+}
+
+// Writers returns the stdout and stderr writers for a host
+func (m *Mux) Writers(host string) (*HostWriter, *HostWriter) {
+	return m.writer(host, m.stdout), m.writer(host, m.stderr)
+}
+
+func (m *Mux) writer(host string, dst io.Writer) *HostWriter {
+	return &HostWriter{mux: m, dst: dst, prefix: m.prefixes[host]}
+}
+
+// Block prints a host's grouped output under a header line
+func (m *Mux) Block(host, header string, stdout, stderr *HostWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	title := fmt.Sprintf("── %s %s", host, header)
+	if m.color {
+		title = m.colors[host] + title + colorReset
+	}
+	fmt.Fprintln(m.stdout, title)
+
+	m.stdout.Write(stdout.held.Bytes())
+	m.stderr.Write(stderr.held.Bytes())
+}
+
+// HostWriter is an io.Writer that prefixes complete lines with a host name
+type HostWriter struct {
+	mux     *Mux
+	dst     io.Writer
+	prefix  string
+	partial []byte
+	held    bytes.Buffer
+}
+
+// Write buffers p and emits every complete line it contains
+func (w *HostWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.partial[:i+1])
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush emits any trailing output that did not end in a newline
+func (w *HostWriter) Flush() {
+	if len(w.partial) == 0 {
+		return
+	}
+	w.emit(append(w.partial, '\n'))
+	w.partial = nil
+}
+
+func (w *HostWriter) emit(line []byte) {
+	if w.mux.group {
+		w.held.Write(line)
+		return
+	}
+
+	w.mux.mu.Lock()
+	defer w.mux.mu.Unlock()
+	io.WriteString(w.dst, w.prefix)
+	w.dst.Write(line)
+}
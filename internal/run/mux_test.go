@@ -0,0 +1,78 @@
+package run
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMux_PrefixesCompleteLines(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	mux := NewMux(&stdout, &stderr, []string{"homelab", "mac"}, false, false)
+
+	a, aErr := mux.Writers("homelab")
+	b, _ := mux.Writers("mac")
+
+	// Partial writes from both hosts must not interleave mid-line
+	a.Write([]byte("building "))
+	b.Write([]byte("testing "))
+	a.Write([]byte("done\nsecond"))
+	b.Write([]byte("ok\n"))
+	aErr.Write([]byte("warning\n"))
+	a.Flush()
+
+	want := "[homelab] building done\n" +
+		"[mac]     testing ok\n" +
+		"[homelab] second\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := stderr.String(); got != "[homelab] warning\n" {
+		t.Errorf("Expected prefixed stderr, got %q", got)
+	}
+}
+
+func TestMux_GroupOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	mux := NewMux(&stdout, &stderr, []string{"homelab", "mac"}, true, false)
+
+	a, aErr := mux.Writers("homelab")
+	b, bErr := mux.Writers("mac")
+
+	a.Write([]byte("one\n"))
+	b.Write([]byte("mac-one\n"))
+	a.Write([]byte("two"))
+	a.Flush()
+
+	if stdout.Len() != 0 {
+		t.Fatalf("Expected no output before Block, got %q", stdout.String())
+	}
+
+	mux.Block("homelab", "(exit 0, 1s)", a, aErr)
+	mux.Block("mac", "(exit 1, 2s)", b, bErr)
+
+	want := "── homelab (exit 0, 1s)\none\ntwo\n" +
+		"── mac (exit 1, 2s)\nmac-one\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMux_Color(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	mux := NewMux(&stdout, &stderr, []string{"a", "b"}, false, true)
+
+	a, _ := mux.Writers("a")
+	b, _ := mux.Writers("b")
+	a.Write([]byte("x\n"))
+	b.Write([]byte("y\n"))
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], colors[0]) || !strings.HasPrefix(lines[1], colors[1]) {
+		t.Errorf("Expected distinct host colors, got %q", lines)
+	}
+}
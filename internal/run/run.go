@@ -1,38 +1,302 @@
 package run
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+// Exit codes used by dw when commands fail on remote hosts
+const (
+	ExitSomeFailed = 2
+	ExitAllFailed  = 3
 )
 
-// OnHost executes a command on a specific host
-func OnHost(host, command string) error {
-	cmd := exec.Command("ssh", host, command)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+// Options controls how OnAll presents output from multiple hosts
+type Options struct {
+	// GroupOutput prints each host's output as one block when it finishes
+	GroupOutput bool
+	// Color assigns each host prefix its own color
+	Color bool
+	// Stdout and Stderr receive multiplexed output, defaulting to the
+	// process streams
+	Stdout io.Writer
+	Stderr io.Writer
+	// Capture stores each host's output in its Result instead of
+	// streaming it
+	Capture bool
+	// Parallel caps how many hosts run at once; 0 means no limit
+	Parallel int
+	// BatchSize runs hosts in consecutive batches of this size, each
+	// finishing before the next starts; 0 means a single batch
+	BatchSize int
+	// FailFast stops dispatching to further hosts once one has failed
+	FailFast bool
+}
+
+// Result holds the outcome of a command on a single host
+type Result struct {
+	Host     string
+	ExitCode int
+	Duration time.Duration
+	Signal   string
+	Err      error
+	// Canceled is set when dw stopped the command before it finished
+	Canceled bool
+	// TimedOut is set when the command was stopped by a deadline
+	TimedOut bool
+	// Skipped is set for hosts the command was never started on
+	Skipped bool
+	// Stdout and Stderr hold the host's output when Options.Capture is set
+	Stdout string
+	Stderr string
+}
+
+// resultDoc is the structured form of a Result
+type resultDoc struct {
+	Host       string `json:"host" yaml:"host"`
+	OK         bool   `json:"ok" yaml:"ok"`
+	ExitCode   int    `json:"exit_code" yaml:"exit_code"`
+	Signal     string `json:"signal,omitempty" yaml:"signal,omitempty"`
+	DurationMS int64  `json:"duration_ms" yaml:"duration_ms"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+	Canceled   bool   `json:"canceled,omitempty" yaml:"canceled,omitempty"`
+	TimedOut   bool   `json:"timed_out,omitempty" yaml:"timed_out,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	Stdout     string `json:"stdout,omitempty" yaml:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty" yaml:"stderr,omitempty"`
+}
+
+func (r Result) doc() resultDoc {
+	d := resultDoc{
+		Host:       r.Host,
+		OK:         !r.Failed() && !r.Skipped,
+		ExitCode:   r.ExitCode,
+		Signal:     r.Signal,
+		DurationMS: r.Duration.Milliseconds(),
+		Canceled:   r.Canceled,
+		TimedOut:   r.TimedOut,
+		Skipped:    r.Skipped,
+		Stdout:     r.Stdout,
+		Stderr:     r.Stderr,
+	}
+	if r.Err != nil {
+		d.Error = r.Err.Error()
+	}
+	return d
+}
+
+// MarshalJSON encodes the result with its error as a string
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.doc())
+}
+
+// MarshalYAML encodes the result with its error as a string
+func (r Result) MarshalYAML() (any, error) {
+	return r.doc(), nil
+}
+
+// Failed reports whether the command did not succeed on the host
+func (r Result) Failed() bool {
+	return r.Err != nil
+}
+
+// Summary returns a short human description of the outcome
+func (r Result) Summary() string {
+	switch {
+	case r.Skipped:
+		return "(skipped)"
+	case r.TimedOut:
+		return fmt.Sprintf("(timed out, %s)", r.Duration.Round(time.Millisecond))
+	case r.Canceled:
+		return fmt.Sprintf("(canceled, %s)", r.Duration.Round(time.Millisecond))
+	case r.Signal != "":
+		return fmt.Sprintf("(%s, %s)", r.Signal, r.Duration.Round(time.Millisecond))
+	default:
+		return fmt.Sprintf("(exit %d, %s)", r.ExitCode, r.Duration.Round(time.Millisecond))
+	}
+}
+
+// OnHost executes a command on a specific host. Cancelling ctx stops
+// the remote command.
+func OnHost(ctx context.Context, t transport.Transport, host, command string) error {
+	return runJob(ctx, t, host, command, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// OnAll executes a command on all hosts in parallel.
+// Output is multiplexed with a per-host prefix and results are
+// returned in the same order as hosts. Cancelling ctx stops the command
+// on every host at once. Hosts are dispatched in order, limited by
+// opts.Parallel and opts.BatchSize; hosts never dispatched are returned
+// as skipped.
+func OnAll(ctx context.Context, t transport.Transport, hosts []string, command string, opts Options) []Result {
+	jobs := make([]Job, len(hosts))
+	for i, h := range hosts {
+		jobs[i] = Job{Host: h, Command: command}
+	}
+	return OnEach(ctx, t, jobs, opts)
+}
 
-	return cmd.Run()
+// Job is a command to run on one host
+type Job struct {
+	Host    string
+	Command string
 }
 
-// OnAll executes a command on all hosts in parallel
-func OnAll(hosts []string, command string) error {
-	errors := make(chan error, len(hosts))
+// OnEach runs each job's command on its host, like OnAll, for callers
+// that give every host different work
+func OnEach(ctx context.Context, t transport.Transport, jobs []Job, opts Options) []Result {
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(jobs)
+	}
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = len(jobs)
+	}
 
-	for _, host := range hosts {
-		go func(h string) {
-			fmt.Printf("\n→ Running on %s\n", h)
-			errors <- OnHost(h, command)
-		}(host)
+	results := make([]Result, len(jobs))
+	hosts := make([]string, len(jobs))
+	for i, job := range jobs {
+		hosts[i] = job.Host
 	}
+	mux := NewMux(opts.Stdout, opts.Stderr, hosts, opts.GroupOutput, opts.Color)
+
+	var failed atomic.Bool
+	for start := 0; start < len(jobs); start += batchSize {
+		slots := make(chan struct{}, parallel)
+		var wg sync.WaitGroup
 
-	var lastErr error
-	for range hosts {
-		if err := <-errors; err != nil {
-			lastErr = err
+		for i := start; i < min(start+batchSize, len(jobs)); i++ {
+			slots <- struct{}{}
+			if ctx.Err() != nil || (opts.FailFast && failed.Load()) {
+				results[i] = Result{Host: hosts[i], Skipped: true}
+				<-slots
+				continue
+			}
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				results[i] = runOne(ctx, t, jobs[i].Host, jobs[i].Command, opts, mux)
+				if results[i].Failed() {
+					failed.Store(true)
+				}
+			}(i)
+		}
+
+		// Each batch finishes before the next one starts
+		wg.Wait()
+	}
+
+	return results
+}
+
+// runOne runs command on a single host for OnAll
+func runOne(ctx context.Context, t transport.Transport, host, command string, opts Options, mux *Mux) Result {
+	if opts.Capture {
+		var stdout, stderr bytes.Buffer
+		start := time.Now()
+		err := runJob(ctx, t, host, command, nil, &stdout, &stderr)
+
+		r := newResult(host, time.Since(start), err)
+		if err != nil {
+			r.TimedOut, r.Canceled = stopped(ctx)
 		}
+		r.Stdout, r.Stderr = stdout.String(), stderr.String()
+		return r
+	}
+
+	stdout, stderr := mux.Writers(host)
+	start := time.Now()
+	err := runJob(ctx, t, host, command, nil, stdout, stderr)
+	stdout.Flush()
+	stderr.Flush()
+
+	r := newResult(host, time.Since(start), err)
+	if err != nil {
+		r.TimedOut, r.Canceled = stopped(ctx)
+	}
+	if opts.GroupOutput {
+		mux.Block(host, r.Summary(), stdout, stderr)
+	}
+	return r
+}
+
+// ExitCode returns the process exit code dw should use for results
+func ExitCode(results []Result) int {
+	failed := len(Failures(results))
+	switch {
+	case failed == 0:
+		return 0
+	case failed == len(results):
+		return ExitAllFailed
+	default:
+		return ExitSomeFailed
+	}
+}
+
+// Failures returns the results that did not succeed, counting hosts the
+// command was skipped on
+func Failures(results []Result) []Result {
+	var failed []Result
+	for _, r := range results {
+		if r.Failed() || r.Skipped {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// sshFailed is the status the ssh client exits with when the connection
+// itself fails
+const sshFailed = 255
+
+// Retryable reports whether err means the command could not reach its
+// host or lost the connection, as opposed to the command itself failing.
+// Such failures are worth retrying on another host.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	code, signal, ok := transport.ExitStatus(err)
+	if !ok {
+		return true
+	}
+	return code == sshFailed && signal == ""
+}
+
+// newResult builds a Result from the error returned by a finished command
+func newResult(host string, duration time.Duration, err error) Result {
+	r := Result{
+		Host:     host,
+		Duration: duration,
+		Err:      err,
+	}
+
+	if err == nil {
+		return r
 	}
 
-	return lastErr
+	r.ExitCode, r.Signal, _ = transport.ExitStatus(err)
+	return r
 }
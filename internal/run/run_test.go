@@ -0,0 +1,481 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/transport"
+)
+
+func TestExitCode(t *testing.T) {
+	ok := Result{Host: "ok"}
+	bad := Result{Host: "bad", ExitCode: 1, Err: errors.New("exit status 1")}
+
+	tests := []struct {
+		name    string
+		results []Result
+		want    int
+	}{
+		{
+			name:    "all succeeded",
+			results: []Result{ok, ok},
+			want:    0,
+		},
+		{
+			name:    "some failed",
+			results: []Result{ok, bad, ok},
+			want:    ExitSomeFailed,
+		},
+		{
+			name:    "all failed",
+			results: []Result{bad, bad},
+			want:    ExitAllFailed,
+		},
+		{
+			name:    "some skipped",
+			results: []Result{ok, {Host: "c", Skipped: true}},
+			want:    ExitSomeFailed,
+		},
+		{
+			name:    "failed then rest skipped",
+			results: []Result{bad, {Host: "c", Skipped: true}},
+			want:    ExitAllFailed,
+		},
+		{
+			name:    "no hosts",
+			results: nil,
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.results); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResult(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		r := newResult("homelab", time.Second, nil)
+		if r.Failed() || r.ExitCode != 0 {
+			t.Errorf("Expected success, got %+v", r)
+		}
+		if r.Duration != time.Second {
+			t.Errorf("Expected duration 1s, got %s", r.Duration)
+		}
+	})
+
+	t.Run("exit code", func(t *testing.T) {
+		err := exec.Command("sh", "-c", "exit 3").Run()
+		r := newResult("homelab", 0, err)
+		if !r.Failed() {
+			t.Fatal("Expected failure")
+		}
+		if r.ExitCode != 3 {
+			t.Errorf("Expected exit code 3, got %d", r.ExitCode)
+		}
+		if r.Signal != "" {
+			t.Errorf("Expected no signal, got %q", r.Signal)
+		}
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		err := exec.Command("sh", "-c", "kill -TERM $$").Run()
+		r := newResult("homelab", 0, err)
+		if r.Signal != "terminated" {
+			t.Errorf("Expected signal 'terminated', got %q", r.Signal)
+		}
+	})
+
+	t.Run("non-exit error", func(t *testing.T) {
+		r := newResult("homelab", 0, errors.New("ssh: not found"))
+		if r.ExitCode != -1 {
+			t.Errorf("Expected exit code -1, got %d", r.ExitCode)
+		}
+	})
+}
+
+func TestOnAll_WithFakeTransport(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"ok":   {Stdout: "built\n"},
+		"fail": {Stdout: "oops\n", ExitCode: 2},
+		"down": {Offline: true},
+	})
+
+	var stdout, stderr bytes.Buffer
+	results := OnAll(context.Background(), fake, []string{"ok", "fail", "down"}, "make", Options{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	want := []struct {
+		host   string
+		failed bool
+		code   int
+	}{
+		{"ok", false, 0},
+		{"fail", true, 2},
+		{"down", true, -1},
+	}
+
+	for i, w := range want {
+		r := results[i]
+		if r.Host != w.host || r.Failed() != w.failed || r.ExitCode != w.code {
+			t.Errorf("results[%d] = %+v, want host=%s failed=%v exit=%d", i, r, w.host, w.failed, w.code)
+		}
+	}
+
+	if ExitCode(results) != ExitSomeFailed {
+		t.Errorf("Expected exit code %d, got %d", ExitSomeFailed, ExitCode(results))
+	}
+
+	out := stdout.String()
+	if !strings.Contains(out, "[ok]   built\n") || !strings.Contains(out, "[fail] oops\n") {
+		t.Errorf("Expected prefixed host output, got:\n%s", out)
+	}
+}
+
+func TestOnAll_Capture(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"ok":   {Stdout: "built\n", Stderr: "warning\n"},
+		"fail": {ExitCode: 1},
+	})
+
+	var stdout bytes.Buffer
+	results := OnAll(context.Background(), fake, []string{"ok", "fail"}, "make", Options{Stdout: &stdout, Capture: true})
+
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing streamed, got %q", stdout.String())
+	}
+	if results[0].Stdout != "built\n" || results[0].Stderr != "warning\n" {
+		t.Errorf("Expected captured output, got %+v", results[0])
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var docs []map[string]any
+	if err := json.Unmarshal(data, &docs); err != nil {
+		t.Fatal(err)
+	}
+	if docs[0]["ok"] != true || docs[0]["stdout"] != "built\n" {
+		t.Errorf("Unexpected document for ok host: %v", docs[0])
+	}
+	if docs[1]["ok"] != false || docs[1]["exit_code"] != 1.0 || docs[1]["error"] == nil {
+		t.Errorf("Unexpected document for failed host: %v", docs[1])
+	}
+}
+
+func TestOnEach(t *testing.T) {
+	echo := func(command string) (string, int) {
+		for _, shard := range []string{"shard-a", "shard-b"} {
+			if strings.Contains(command, shard) {
+				return shard + "\n", 0
+			}
+		}
+		return "", 1
+	}
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"h1": {Respond: echo},
+		"h2": {Respond: echo},
+	})
+
+	results := OnEach(context.Background(), fake, []Job{
+		{Host: "h1", Command: "test shard-a"},
+		{Host: "h2", Command: "test shard-b"},
+	}, Options{Capture: true})
+
+	if results[0].Host != "h1" || results[0].Stdout != "shard-a\n" {
+		t.Errorf("h1 result = %+v, want its own command's output", results[0])
+	}
+	if results[1].Host != "h2" || results[1].Stdout != "shard-b\n" {
+		t.Errorf("h2 result = %+v, want its own command's output", results[1])
+	}
+}
+
+// hangTransport is a Fake whose commands run until the connection drops
+type hangTransport struct {
+	*transport.Fake
+}
+
+func (hangTransport) Run(ctx context.Context, host, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestOnAll_CancelStopsRemoteJobs(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"a": {},
+		"b": {},
+	})
+
+	defer func(wait time.Duration) { disconnectWait = wait }(disconnectWait)
+	disconnectWait = 200 * time.Millisecond
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(20*time.Millisecond, func() { cancel(Interrupt{Signal: syscall.SIGTERM}) })
+
+	start := time.Now()
+	results := OnAll(ctx, hangTransport{fake}, []string{"a", "b"}, "make", Options{Capture: true})
+
+	// The commands never exit on their own, so both hosts wait out the
+	// disconnect together rather than one after the other
+	if elapsed := time.Since(start); elapsed > 3*disconnectWait/2 {
+		t.Errorf("Expected hosts to be stopped concurrently, took %s", elapsed)
+	}
+
+	for _, r := range results {
+		if !r.Canceled || !r.Failed() {
+			t.Errorf("Expected %s to be canceled, got %+v", r.Host, r)
+		}
+	}
+
+	stops := 0
+	for _, call := range fake.Calls() {
+		if strings.Contains(call.Command, "kill -s TERM") {
+			stops++
+		}
+	}
+	if stops != 2 {
+		t.Errorf("Expected a TERM stop sent to each host, got %d", stops)
+	}
+}
+
+// killedTransport is a Fake whose local ssh dies from a signal at once,
+// as it does when a Ctrl-C reaches it before dw cancels
+type killedTransport struct {
+	*transport.Fake
+}
+
+func (killedTransport) Run(ctx context.Context, host, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	return exec.Command("sh", "-c", "kill -INT $$").Run()
+}
+
+func TestOnAll_CancelAfterTransportReturns(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{"a": {}})
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(20*time.Millisecond, func() { cancel(Interrupt{Signal: syscall.SIGINT}) })
+
+	results := OnAll(ctx, killedTransport{fake}, []string{"a"}, "make", Options{Capture: true})
+
+	if !results[0].Failed() {
+		t.Errorf("Expected a failure, got %+v", results[0])
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0].Command, "kill -s INT") {
+		t.Errorf("Expected the remote job to be stopped with INT, got %v", calls)
+	}
+}
+
+func TestStopSignal(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(Interrupt{Signal: os.Interrupt})
+	if got := stopSignal(ctx); got != "INT" {
+		t.Errorf("stopSignal(SIGINT) = %s, want INT", got)
+	}
+
+	ctx, cancel = context.WithCancelCause(context.Background())
+	cancel(Interrupt{Signal: syscall.SIGTERM})
+	if got := stopSignal(ctx); got != "TERM" {
+		t.Errorf("stopSignal(SIGTERM) = %s, want TERM", got)
+	}
+}
+
+func TestOnAll_TimeoutReportedDistinctly(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"hung": {},
+	})
+
+	defer func(wait time.Duration) { disconnectWait = wait }(disconnectWait)
+	disconnectWait = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	results := OnAll(ctx, hangTransport{fake}, []string{"hung"}, "make test", Options{Capture: true})
+
+	r := results[0]
+	if !r.TimedOut || r.Canceled {
+		t.Errorf("Expected a timeout rather than a cancellation, got %+v", r)
+	}
+	if !strings.HasPrefix(r.Summary(), "(timed out") {
+		t.Errorf("Expected timed out summary, got %s", r.Summary())
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 1 || !strings.Contains(calls[0].Command, "kill -s TERM") {
+		t.Errorf("Expected the job to be stopped with TERM, got %v", calls)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"success", nil, false},
+		{"command failed", &transport.ExitError{Code: 1}, false},
+		{"ssh connection failed", exec.Command("sh", "-c", "exit 255").Run(), true},
+		{"connection refused", transport.ErrUnreachable, true},
+		{"killed by signal", exec.Command("sh", "-c", "kill -KILL $$").Run(), false},
+		{"canceled", context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// trackingTransport is a Fake that records how many commands run at once
+// and the order they start in
+type trackingTransport struct {
+	*transport.Fake
+
+	mu      sync.Mutex
+	running int
+	peak    int
+	started []string
+}
+
+func (tt *trackingTransport) Run(ctx context.Context, host, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	tt.mu.Lock()
+	tt.running++
+	tt.peak = max(tt.peak, tt.running)
+	tt.started = append(tt.started, host)
+	tt.mu.Unlock()
+
+	defer func() {
+		tt.mu.Lock()
+		tt.running--
+		tt.mu.Unlock()
+	}()
+
+	return tt.Fake.Run(ctx, host, command, stdin, stdout, stderr)
+}
+
+func TestOnAll_Dispatch(t *testing.T) {
+	hosts := []string{"a", "b", "c", "d", "e"}
+
+	tests := []struct {
+		name        string
+		opts        Options
+		failing     string
+		wantPeak    int
+		wantSkipped []string
+	}{
+		{
+			name:     "unbounded",
+			opts:     Options{},
+			wantPeak: 5,
+		},
+		{
+			name:     "parallel limit",
+			opts:     Options{Parallel: 2},
+			wantPeak: 2,
+		},
+		{
+			name:     "serial",
+			opts:     Options{BatchSize: 1},
+			wantPeak: 1,
+		},
+		{
+			name:     "batches",
+			opts:     Options{BatchSize: 3},
+			wantPeak: 3,
+		},
+		{
+			name:        "fail fast",
+			opts:        Options{BatchSize: 1, FailFast: true},
+			failing:     "b",
+			wantPeak:    1,
+			wantSkipped: []string{"c", "d", "e"},
+		},
+		{
+			name:     "failure without fail fast",
+			opts:     Options{BatchSize: 1},
+			failing:  "b",
+			wantPeak: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeHosts := make(map[string]*transport.FakeHost)
+			for _, h := range hosts {
+				fakeHosts[h] = &transport.FakeHost{Delay: 30 * time.Millisecond}
+			}
+			if tt.failing != "" {
+				fakeHosts[tt.failing].ExitCode = 1
+			}
+
+			tr := &trackingTransport{Fake: transport.NewFake(fakeHosts)}
+			tt.opts.Capture = true
+			results := OnAll(context.Background(), tr, hosts, "make", tt.opts)
+
+			if tr.peak != tt.wantPeak {
+				t.Errorf("Expected at most %d hosts at once, got %d", tt.wantPeak, tr.peak)
+			}
+
+			var skipped []string
+			for _, r := range results {
+				if r.Skipped {
+					skipped = append(skipped, r.Host)
+				}
+			}
+			if strings.Join(skipped, ",") != strings.Join(tt.wantSkipped, ",") {
+				t.Errorf("Expected skipped %v, got %v", tt.wantSkipped, skipped)
+			}
+
+			// Rolling runs start hosts in order
+			if tt.opts.BatchSize == 1 {
+				want := hosts[:len(hosts)-len(tt.wantSkipped)]
+				if strings.Join(tr.started, ",") != strings.Join(want, ",") {
+					t.Errorf("Expected hosts started in order %v, got %v", want, tr.started)
+				}
+			}
+		})
+	}
+}
+
+func TestOnAll_FailFastExitCode(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"a": {ExitCode: 1},
+		"b": {},
+	})
+
+	results := OnAll(context.Background(), fake, []string{"a", "b"}, "make", Options{BatchSize: 1, FailFast: true, Capture: true})
+
+	if !results[1].Skipped || results[1].Failed() {
+		t.Errorf("Expected b to be skipped, got %+v", results[1])
+	}
+	// No host succeeded, since skipped hosts count as failed
+	if got := ExitCode(results); got != ExitAllFailed {
+		t.Errorf("Expected exit code %d, got %d", ExitAllFailed, got)
+	}
+}
@@ -1,13 +1,15 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 
-	"github.com/WillyV3/distributed/internal/ui"
+	"github.com/WillyV3/distributed/internal/transport"
 )
 
 // defaultExcludes are patterns to exclude from sync
@@ -24,28 +26,80 @@ var defaultExcludes = []string{
 	".next",
 	"target",
 	".terraform",
+	".dw",
 }
 
-// Push syncs a local directory to remote host(s)
-func Push(localPath string, hosts []string, dryRun bool) error {
+// ArtifactDir is where artifacts pulled from several hosts are kept, one
+// subdirectory per host, relative to the synced directory
+const ArtifactDir = ".dw/artifacts"
+
+// Layout says where local directories are mirrored on remote hosts and
+// what is left out. The zero Layout mirrors paths under $HOME to the same
+// path under the remote user's home and skips the default excludes.
+type Layout struct {
+	// Root is a local directory mirrored at RemoteRoot instead, along with
+	// everything under it. Empty means no such directory.
+	Root       string
+	RemoteRoot string
+	// Exclude lists rsync patterns skipped on top of the default excludes
+	Exclude []string
+}
+
+// MirrorPath resolves a local path and returns where Push mirrors it on
+// remote hosts with the zero Layout
+func MirrorPath(localPath string) (absPath, remotePath string, err error) {
+	return Layout{}.MirrorPath(localPath)
+}
+
+// Push syncs a local directory to remote host(s) with the zero Layout
+func Push(ctx context.Context, t transport.Transport, localPath string, hosts []string, dryRun bool) error {
+	return Layout{}.Push(ctx, t, localPath, hosts, dryRun)
+}
+
+// PullArtifacts pulls files from host's mirror of localPath with the zero
+// Layout; see Layout.PullArtifacts
+func PullArtifacts(ctx context.Context, t transport.Transport, host, localPath, dest string, patterns []string) error {
+	return Layout{}.PullArtifacts(ctx, t, host, localPath, dest, patterns)
+}
+
+// MirrorPath resolves a local path and returns where Push mirrors it on
+// remote hosts. Paths under Root map to the same path under RemoteRoot;
+// other paths under $HOME map to the same path under the remote user's
+// home, e.g. ~/projects/myapp.
+func (l Layout) MirrorPath(localPath string) (absPath, remotePath string, err error) {
 	// Resolve to absolute path
-	absPath, err := filepath.Abs(localPath)
+	absPath, err = filepath.Abs(localPath)
 	if err != nil {
-		return fmt.Errorf("invalid path: %w", err)
+		return "", "", fmt.Errorf("invalid path: %w", err)
 	}
 
-	// Verify path exists
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		return fmt.Errorf("path does not exist: %s", absPath)
+	if l.Root != "" {
+		if rel, err := filepath.Rel(l.Root, absPath); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return absPath, path.Join(l.RemoteRoot, filepath.ToSlash(rel)), nil
+		}
 	}
 
 	// Convert to relative path from home for remote
 	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	remotePath = strings.Replace(absPath, home, "~", 1)
+	return absPath, remotePath, nil
+}
+
+// Push syncs a local directory to remote host(s)
+func (l Layout) Push(ctx context.Context, t transport.Transport, localPath string, hosts []string, dryRun bool) error {
+	absPath, remotePath, err := l.MirrorPath(localPath)
 	if err != nil {
 		return err
 	}
 
-	remotePath := strings.Replace(absPath, home, "~", 1)
+	// Verify path exists
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		return fmt.Errorf("path does not exist: %s", absPath)
+	}
 
 	// Build rsync args
 	args := []string{
@@ -58,17 +112,17 @@ func Push(localPath string, hosts []string, dryRun bool) error {
 	}
 
 	// Add excludes
-	for _, exclude := range defaultExcludes {
+	for _, exclude := range l.excludes() {
 		args = append(args, "--exclude", exclude)
 	}
 
 	// Sync to each host
 	for _, host := range hosts {
-		hostArgs := append(args, absPath+"/", host+":"+remotePath+"/")
+		hostArgs := append(slices.Clip(args), absPath+"/", host+":"+remotePath+"/")
 
 		title := fmt.Sprintf("Syncing to %s:%s", host, remotePath)
 
-		if err := ui.SpinCommand(title, "rsync", hostArgs...); err != nil {
+		if err := t.Rsync(ctx, title, hostArgs...); err != nil {
 			return fmt.Errorf("rsync to %s failed: %w", host, err)
 		}
 	}
@@ -77,7 +131,7 @@ func Push(localPath string, hosts []string, dryRun bool) error {
 }
 
 // Pull syncs from a remote host to local
-func Pull(host, remotePath, localPath string) error {
+func Pull(ctx context.Context, t transport.Transport, host, remotePath, localPath string) error {
 	// Ensure local directory exists
 	if err := os.MkdirAll(localPath, 0755); err != nil {
 		return fmt.Errorf("failed to create local directory: %w", err)
@@ -90,15 +144,65 @@ func Pull(host, remotePath, localPath string) error {
 		localPath + "/",
 	}
 
-	cmd := exec.Command("rsync", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	title := fmt.Sprintf("Pulling from %s:%s", host, remotePath)
 
-	fmt.Printf("← Pulling from %s:%s\n", host, remotePath)
+	if err := t.Rsync(ctx, title, args...); err != nil {
+		return fmt.Errorf("rsync from %s failed: %w", host, err)
+	}
 
-	if err := cmd.Run(); err != nil {
+	return nil
+}
+
+// PullArtifacts copies files matching patterns from host's mirror of
+// localPath into dest. Patterns are rsync globs relative to the mirror;
+// a pattern naming a directory brings its whole contents. Without
+// patterns the whole mirror is pulled, minus the excludes.
+func (l Layout) PullArtifacts(ctx context.Context, t transport.Transport, host, localPath, dest string, patterns []string) error {
+	_, remotePath, err := l.MirrorPath(localPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("failed to create local directory: %w", err)
+	}
+
+	args := []string{
+		"-avz",
+		"--progress",
+	}
+	args = append(args, artifactFilters(patterns, l.excludes())...)
+	args = append(args, host+":"+remotePath+"/", dest+"/")
+
+	title := fmt.Sprintf("Pulling artifacts from %s:%s", host, remotePath)
+
+	if err := t.Rsync(ctx, title, args...); err != nil {
 		return fmt.Errorf("rsync from %s failed: %w", host, err)
 	}
 
 	return nil
 }
+
+// excludes returns the default excludes followed by the layout's own
+func (l Layout) excludes() []string {
+	return append(slices.Clip(defaultExcludes), l.Exclude...)
+}
+
+// artifactFilters builds rsync filter args that keep only paths matching
+// patterns, skipping directories left empty. Without patterns everything
+// but excludes is kept.
+func artifactFilters(patterns, excludes []string) []string {
+	var args []string
+	if len(patterns) == 0 {
+		for _, exclude := range excludes {
+			args = append(args, "--exclude", exclude)
+		}
+		return args
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		args = append(args, "--include", pattern, "--include", pattern+"/***")
+	}
+	return append(args, "--include", "*/", "--exclude", "*", "--prune-empty-dirs")
+}
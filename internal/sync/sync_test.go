@@ -1,10 +1,13 @@
 package sync
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/WillyV3/distributed/internal/transport"
 )
 
 func TestDefaultExcludes(t *testing.T) {
@@ -251,3 +254,152 @@ func TestPullPathConstruction(t *testing.T) {
 		})
 	}
 }
+
+func TestPush_WithFakeTransport(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"homelab": {},
+		"server":  {},
+	})
+
+	dir := t.TempDir()
+	if err := Push(context.Background(), fake, dir, []string{"homelab", "server"}, true); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	rsyncs := fake.Rsyncs()
+	if len(rsyncs) != 2 {
+		t.Fatalf("Expected 2 rsync invocations, got %d", len(rsyncs))
+	}
+
+	for i, host := range []string{"homelab", "server"} {
+		args := rsyncs[i]
+		if !strings.Contains(strings.Join(args, " "), "--dry-run") {
+			t.Errorf("Expected --dry-run in args for %s: %v", host, args)
+		}
+
+		dest := args[len(args)-1]
+		if !strings.HasPrefix(dest, host+":") {
+			t.Errorf("Expected destination on %s, got %s", host, dest)
+		}
+		if src := args[len(args)-2]; src != dir+"/" {
+			t.Errorf("Expected source %s/, got %s", dir, src)
+		}
+	}
+}
+
+func TestPush_OfflineHost(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"down": {Offline: true},
+	})
+
+	if err := Push(context.Background(), fake, t.TempDir(), []string{"down"}, false); err == nil {
+		t.Error("Expected error pushing to offline host")
+	}
+}
+
+func TestPush_MissingPath(t *testing.T) {
+	fake := transport.NewFake(nil)
+
+	if err := Push(context.Background(), fake, filepath.Join(t.TempDir(), "missing"), []string{"homelab"}, false); err == nil {
+		t.Error("Expected error for missing path")
+	}
+	if len(fake.Rsyncs()) != 0 {
+		t.Error("Expected no rsync for missing path")
+	}
+}
+
+func TestMirrorPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	abs, remote, err := MirrorPath(filepath.Join(home, "projects", "myapp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if abs != filepath.Join(home, "projects", "myapp") {
+		t.Errorf("Expected absolute path under home, got %s", abs)
+	}
+	if remote != "~/projects/myapp" {
+		t.Errorf("Expected ~/projects/myapp, got %s", remote)
+	}
+}
+
+func TestArtifactFilters(t *testing.T) {
+	got := strings.Join(artifactFilters([]string{"bin/", "*.tar.gz"}, defaultExcludes), " ")
+	want := "--include bin --include bin/*** --include *.tar.gz --include *.tar.gz/*** " +
+		"--include */ --exclude * --prune-empty-dirs"
+	if got != want {
+		t.Errorf("artifactFilters() = %s, want %s", got, want)
+	}
+
+	// Without patterns the whole mirror comes back, minus the usual junk
+	if got := strings.Join(artifactFilters(nil, defaultExcludes), " "); !strings.Contains(got, "--exclude node_modules") {
+		t.Errorf("Expected default excludes, got %s", got)
+	}
+}
+
+func TestPullArtifacts_WithFakeTransport(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	fake := transport.NewFake(map[string]*transport.FakeHost{
+		"homelab": {},
+	})
+
+	project := filepath.Join(home, "projects", "myapp")
+	dest := filepath.Join(project, ArtifactDir, "homelab")
+	if err := PullArtifacts(context.Background(), fake, "homelab", project, dest, []string{"bin/app"}); err != nil {
+		t.Fatalf("PullArtifacts failed: %v", err)
+	}
+
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("Expected destination to be created: %v", err)
+	}
+
+	args := fake.Rsyncs()[0]
+	if src := args[len(args)-2]; src != "homelab:~/projects/myapp/" {
+		t.Errorf("Expected source homelab:~/projects/myapp/, got %s", src)
+	}
+	if got := args[len(args)-1]; got != dest+"/" {
+		t.Errorf("Expected destination %s/, got %s", dest, got)
+	}
+}
+
+func TestLayout_MirrorPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	root := filepath.Join(home, "projects", "myapp")
+	layout := Layout{Root: root, RemoteRoot: "~/src/app"}
+
+	tests := []struct {
+		local string
+		want  string
+	}{
+		{local: root, want: "~/src/app"},
+		{local: filepath.Join(root, "web"), want: "~/src/app/web"},
+		{local: filepath.Join(home, "projects", "myapp2"), want: "~/projects/myapp2"},
+		{local: filepath.Join(home, "projects"), want: "~/projects"},
+	}
+	for _, tt := range tests {
+		if _, got, err := layout.MirrorPath(tt.local); err != nil || got != tt.want {
+			t.Errorf("MirrorPath(%s) = %s, %v, want %s", tt.local, got, err, tt.want)
+		}
+	}
+}
+
+func TestLayout_PushExcludes(t *testing.T) {
+	fake := transport.NewFake(map[string]*transport.FakeHost{"homelab": {}})
+
+	layout := Layout{Exclude: []string{"*.log", "tmp/"}}
+	if err := layout.Push(context.Background(), fake, t.TempDir(), []string{"homelab"}, false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	args := strings.Join(fake.Rsyncs()[0], " ")
+	for _, want := range []string{"--exclude node_modules", "--exclude *.log", "--exclude tmp/"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Expected %q in %s", want, args)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package tailscale discovers hosts from the peers of the local tailnet
+package tailscale
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/WillyV3/distributed/internal/config"
+)
+
+// GroupPrefix marks a group that is resolved from the tailnet, e.g.
+// "tailscale:tag:build"
+const GroupPrefix = "tailscale:"
+
+// Status is the part of tailscale status --json dw reads
+type Status struct {
+	Self           *Peer            `json:"Self"`
+	Peer           map[string]*Peer `json:"Peer"`
+	MagicDNSSuffix string           `json:"MagicDNSSuffix"`
+}
+
+// Peer is one machine on the tailnet
+type Peer struct {
+	HostName     string   `json:"HostName"`
+	DNSName      string   `json:"DNSName"`
+	OS           string   `json:"OS"`
+	TailscaleIPs []string `json:"TailscaleIPs"`
+	Tags         []string `json:"Tags"`
+	Online       bool     `json:"Online"`
+}
+
+// Parse reads the output of tailscale status --json
+func Parse(data []byte) (*Status, error) {
+	var s Status
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid tailscale status: %w", err)
+	}
+	return &s, nil
+}
+
+// ReadFile reads tailscale status --json output saved to path
+func ReadFile(path string) (*Status, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Query runs command (usually "tailscale") with status --json
+func Query(ctx context.Context, command string) (*Status, error) {
+	cmd := exec.CommandContext(ctx, command, "status", "--json")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("tailscale status: %s", msg)
+		}
+		return nil, fmt.Errorf("tailscale status: %w", err)
+	}
+	return Parse(out)
+}
+
+// Load reads the status the way cfg asks: from StatusFile when set,
+// otherwise by running the tailscale CLI
+func Load(ctx context.Context, cfg config.Tailscale) (*Status, error) {
+	if cfg.StatusFile != "" {
+		return ReadFile(cfg.StatusPath())
+	}
+	return Query(ctx, cfg.CLI())
+}
+
+// Peers returns every peer except this machine, sorted by name
+func (s *Status) Peers() []*Peer {
+	peers := make([]*Peer, 0, len(s.Peer))
+	for _, p := range s.Peer {
+		peers = append(peers, p)
+	}
+	slices.SortFunc(peers, func(a, b *Peer) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return peers
+}
+
+// Name returns the peer's MagicDNS short name, e.g. "homelab" for
+// homelab.tail1234.ts.net
+func (p *Peer) Name() string {
+	if name, _, _ := strings.Cut(p.DNSName, "."); name != "" {
+		return name
+	}
+	return strings.ToLower(p.HostName)
+}
+
+// Address returns the peer's MagicDNS name, or its first Tailscale IP
+// when it has none
+func (p *Peer) Address() string {
+	if name := strings.TrimSuffix(p.DNSName, "."); name != "" {
+		return name
+	}
+	if len(p.TailscaleIPs) > 0 {
+		return p.TailscaleIPs[0]
+	}
+	return p.HostName
+}
+
+// Alias returns the ssh config alias that connects to the peer, so hosts
+// already set up with a user or key keep using it. Peers without one are
+// reached by their MagicDNS short name.
+func (p *Peer) Alias(sshHosts []config.SSHHost) string {
+	for _, h := range sshHosts {
+		target := strings.TrimSuffix(strings.ToLower(h.Hostname), ".")
+		if target == "" || strings.ContainsAny(h.Alias, "*?") {
+			continue
+		}
+		if target == strings.ToLower(strings.TrimSuffix(p.DNSName, ".")) || slices.Contains(p.TailscaleIPs, target) {
+			return h.Alias
+		}
+	}
+	return p.Name()
+}
+
+// Filter selects peers for a tailscale: group
+type Filter struct {
+	// kind is "all", "tag", "os" or "name"
+	kind  string
+	value string
+}
+
+// ParseFilter parses what follows "tailscale:" in a group name: "all",
+// "tag:<name>", "os:<os>" or "name:<peer>"
+func ParseFilter(expr string) (Filter, error) {
+	expr = strings.TrimPrefix(expr, GroupPrefix)
+	if expr == "all" || expr == "*" {
+		return Filter{kind: "all"}, nil
+	}
+
+	kind, value, ok := strings.Cut(expr, ":")
+	if !ok || value == "" || !slices.Contains([]string{"tag", "os", "name"}, kind) {
+		return Filter{}, fmt.Errorf("invalid tailscale group %q: use tailscale:all, tailscale:tag:<tag>, tailscale:os:<os> or tailscale:name:<peer>", GroupPrefix+expr)
+	}
+	return Filter{kind: kind, value: value}, nil
+}
+
+// Matches reports whether the peer is selected by the filter
+func (f Filter) Matches(p *Peer) bool {
+	switch f.kind {
+	case "all":
+		return true
+	case "tag":
+		return slices.Contains(p.Tags, "tag:"+f.value)
+	case "os":
+		return strings.EqualFold(p.OS, f.value)
+	case "name":
+		return p.Name() == strings.ToLower(f.value)
+	}
+	return false
+}
+
+// Resolve returns the hosts of a tailscale: group: the online peers the
+// filter selects, named by Alias
+func Resolve(s *Status, group string, sshHosts []config.SSHHost) ([]string, error) {
+	filter, err := ParseFilter(group)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, p := range s.Peers() {
+		if p.Online && filter.Matches(p) {
+			hosts = append(hosts, p.Alias(sshHosts))
+		}
+	}
+	return hosts, nil
+}
@@ -0,0 +1,110 @@
+package tailscale
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/WillyV3/distributed/internal/config"
+)
+
+func loadFixture(t *testing.T) *Status {
+	t.Helper()
+	s, err := ReadFile("testdata/status.json")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return s
+}
+
+func TestPeers(t *testing.T) {
+	s := loadFixture(t)
+
+	var names []string
+	for _, p := range s.Peers() {
+		names = append(names, p.Name())
+	}
+	want := []string{"build-2", "build-3", "homelab", "pixel", "sonia-mac"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected peers %v, got %v", want, names)
+	}
+
+	if s.Self == nil || s.Self.Name() != "willys-mbp" {
+		t.Errorf("Expected self willys-mbp, got %+v", s.Self)
+	}
+}
+
+func TestPeer_Address(t *testing.T) {
+	s := loadFixture(t)
+
+	tests := map[string]string{
+		"nodekey:aaaa": "homelab.tail1234.ts.net",
+		"nodekey:eeee": "100.72.192.90",
+	}
+	for key, want := range tests {
+		if got := s.Peer[key].Address(); got != want {
+			t.Errorf("Address() of %s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestPeer_Alias(t *testing.T) {
+	s := loadFixture(t)
+	sshHosts := []config.SSHHost{
+		{Alias: "*", Hostname: "100.72.192.70"},
+		{Alias: "lab", Hostname: "100.72.192.70", User: "wv3"},
+		{Alias: "sonia", Hostname: "Sonia-Mac.tail1234.ts.net"},
+	}
+
+	tests := map[string]string{
+		"nodekey:aaaa": "lab",     // matched by Tailscale IP
+		"nodekey:dddd": "sonia",   // matched by MagicDNS name
+		"nodekey:bbbb": "build-2", // no ssh config entry
+	}
+	for key, want := range tests {
+		if got := s.Peer[key].Alias(sshHosts); got != want {
+			t.Errorf("Alias() of %s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	s := loadFixture(t)
+
+	tests := []struct {
+		group string
+		want  []string
+	}{
+		{"tailscale:tag:build", []string{"build-2", "homelab"}},
+		{"tailscale:tag:server", []string{"homelab"}},
+		{"tailscale:tag:gpu", nil},
+		{"tailscale:os:macos", []string{"sonia-mac"}},
+		{"tailscale:name:homelab", []string{"homelab"}},
+		{"tailscale:all", []string{"build-2", "homelab", "pixel", "sonia-mac"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			got, err := Resolve(s, tt.group, nil)
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseFilter_Invalid(t *testing.T) {
+	for _, group := range []string{"tailscale:", "tailscale:tag", "tailscale:tag:", "tailscale:color:red"} {
+		if _, err := ParseFilter(group); err == nil {
+			t.Errorf("Expected error for %q", group)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	if _, err := Parse([]byte("not json")); err == nil {
+		t.Error("Expected error for malformed status")
+	}
+}
@@ -0,0 +1,62 @@
+package transport
+
+import "strings"
+
+// Endpoint says how to reach a host that ~/.ssh/config doesn't describe,
+// such as one from an inventory. Empty fields leave ssh's own settings
+// for the host in place.
+type Endpoint struct {
+	Address string
+	User    string
+	Port    string
+}
+
+// Resolver returns the endpoint of a host, if it has one
+type Resolver func(host string) (Endpoint, bool)
+
+// sshOptions returns the ssh -o arguments that apply e
+func (e Endpoint) sshOptions() []string {
+	var opts []string
+	if e.Address != "" {
+		opts = append(opts, "-o", "HostName="+e.Address)
+	}
+	if e.User != "" {
+		opts = append(opts, "-o", "User="+e.User)
+	}
+	if e.Port != "" {
+		opts = append(opts, "-o", "Port="+e.Port)
+	}
+	return opts
+}
+
+// sshArgs returns the ssh arguments that reach host: its endpoint
+// options, if any, followed by host itself
+func sshArgs(resolve Resolver, host string) []string {
+	if resolve != nil {
+		if e, ok := resolve(host); ok {
+			return append(e.sshOptions(), host)
+		}
+	}
+	return []string{host}
+}
+
+// rsyncArgs makes rsync's ssh use the endpoint of the host named in a
+// host:path argument
+func rsyncArgs(resolve Resolver, args []string) []string {
+	if resolve == nil {
+		return args
+	}
+	for _, arg := range args {
+		host, _, ok := strings.Cut(arg, ":")
+		if !ok || host == "" || strings.HasPrefix(arg, "-") {
+			continue
+		}
+		if e, ok := resolve(host); ok {
+			if opts := e.sshOptions(); len(opts) > 0 {
+				return append([]string{"-e", "ssh " + strings.Join(opts, " ")}, args...)
+			}
+		}
+		break
+	}
+	return args
+}
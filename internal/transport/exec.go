@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/WillyV3/distributed/internal/ui"
+)
+
+// Exec is a Transport that shells out to the ssh binary for every command
+type Exec struct {
+	// Resolve, if set, supplies endpoints for hosts ssh can't resolve itself
+	Resolve Resolver
+}
+
+// Run executes a command through the ssh binary. ssh runs in its own
+// process group, so a Ctrl-C reaches only dw, which stops the remote
+// command itself. The exception is ssh reading from the terminal, which
+// only the foreground process group may do.
+func (e Exec) Run(ctx context.Context, host, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, "ssh", append(sshArgs(e.Resolve, host), command)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Stdin = stdin
+	if !isTerminal(stdin) {
+		ui.OwnProcessGroup(cmd)
+	}
+
+	return cmd.Run()
+}
+
+// Output executes a command through the ssh binary and captures stdout
+func (e Exec) Output(ctx context.Context, host, command string) ([]byte, error) {
+	args := append([]string{"-o", "LogLevel=QUIET"}, sshArgs(e.Resolve, host)...)
+	cmd := exec.CommandContext(ctx, "ssh", append(args, command)...)
+	ui.OwnProcessGroup(cmd)
+	return cmd.Output()
+}
+
+// Check tests reachability with a throwaway ssh connection
+func (e Exec) Check(ctx context.Context, host string) bool {
+	args := append([]string{"-o", "ConnectTimeout=2", "-o", "BatchMode=yes"}, sshArgs(e.Resolve, host)...)
+	cmd := exec.CommandContext(ctx, "ssh", append(args, "exit")...)
+	ui.OwnProcessGroup(cmd)
+
+	return cmd.Run() == nil
+}
+
+// Rsync runs rsync with args
+func (e Exec) Rsync(ctx context.Context, title string, args ...string) error {
+	return rsync(ctx, title, rsyncArgs(e.Resolve, args)...)
+}
+
+// Close is a no-op since Exec holds no connections
+func (Exec) Close() error {
+	return nil
+}
+
+// isTerminal reports whether r is a terminal
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
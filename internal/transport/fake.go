@@ -0,0 +1,148 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnreachable is returned by Fake for offline or unknown hosts
+var ErrUnreachable = errors.New("connection refused")
+
+// FakeHost scripts how a simulated host responds to commands
+type FakeHost struct {
+	// Offline makes every connection attempt fail
+	Offline bool
+	// Delay is added before the host responds to anything
+	Delay time.Duration
+	// Stdout is written by Run and returned by Output
+	Stdout string
+	// Stderr is written by Run
+	Stderr string
+	// ExitCode is the exit status of every command
+	ExitCode int
+	// Respond, if set, overrides Stdout and ExitCode per command
+	Respond func(command string) (stdout string, exitCode int)
+}
+
+// Call records a command issued to a Fake
+type Call struct {
+	Host    string
+	Command string
+}
+
+// Fake is an in-process Transport that simulates hosts for tests.
+// Hosts missing from Hosts behave as offline.
+type Fake struct {
+	Hosts map[string]*FakeHost
+
+	mu     sync.Mutex
+	calls  []Call
+	rsyncs [][]string
+}
+
+// NewFake creates a Fake with the given scripted hosts
+func NewFake(hosts map[string]*FakeHost) *Fake {
+	return &Fake{Hosts: hosts}
+}
+
+// Run simulates executing a command on a host
+func (f *Fake) Run(ctx context.Context, host, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	out, err := f.exec(ctx, host, command)
+	if h := f.Hosts[host]; h != nil && !h.Offline {
+		io.WriteString(stdout, out)
+		io.WriteString(stderr, h.Stderr)
+	}
+	return err
+}
+
+// Output simulates executing a command and returns its standard output
+func (f *Fake) Output(ctx context.Context, host, command string) ([]byte, error) {
+	out, err := f.exec(ctx, host, command)
+	return []byte(out), err
+}
+
+// Check reports whether host is online and responds before ctx is done
+func (f *Fake) Check(ctx context.Context, host string) bool {
+	h := f.Hosts[host]
+	if h == nil || h.Offline {
+		return false
+	}
+	select {
+	case <-time.After(h.Delay):
+		return ctx.Err() == nil
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Rsync records the rsync arguments without transferring anything
+func (f *Fake) Rsync(ctx context.Context, title string, args ...string) error {
+	f.mu.Lock()
+	f.rsyncs = append(f.rsyncs, args)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The destination (or source, for pulls) names the host
+	for _, arg := range args {
+		if host, _, ok := strings.Cut(arg, ":"); ok && !strings.HasPrefix(arg, "-") {
+			if h := f.Hosts[host]; h == nil || h.Offline {
+				return fmt.Errorf("%s: %w", host, ErrUnreachable)
+			}
+		}
+	}
+	return nil
+}
+
+// Close is a no-op
+func (f *Fake) Close() error {
+	return nil
+}
+
+// Calls returns every command issued through Run or Output
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Rsyncs returns the arguments of every Rsync invocation
+func (f *Fake) Rsyncs() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string(nil), f.rsyncs...)
+}
+
+func (f *Fake) exec(ctx context.Context, host, command string) (string, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Host: host, Command: command})
+	f.mu.Unlock()
+
+	h := f.Hosts[host]
+	if h == nil || h.Offline {
+		return "", fmt.Errorf("%s: %w", host, ErrUnreachable)
+	}
+
+	select {
+	case <-time.After(h.Delay):
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	out, code := h.Stdout, h.ExitCode
+	if h.Respond != nil {
+		out, code = h.Respond(command)
+	}
+
+	if code != 0 {
+		return out, &ExitError{Code: code}
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	f := NewFake(map[string]*FakeHost{
+		"up":   {Stdout: "hello\n", Stderr: "warn\n"},
+		"down": {Offline: true},
+		"slow": {Delay: 50 * time.Millisecond},
+		"fail": {ExitCode: 3},
+		"echo": {Respond: func(command string) (string, int) { return command, 0 }},
+	})
+
+	var stdout, stderr bytes.Buffer
+	if err := f.Run(context.Background(), "up", "ls", nil, &stdout, &stderr); err != nil {
+		t.Fatalf("Run on up host failed: %v", err)
+	}
+	if stdout.String() != "hello\n" || stderr.String() != "warn\n" {
+		t.Errorf("Unexpected output: stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+
+	if _, err := f.Output(context.Background(), "down", "ls"); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable for offline host, got %v", err)
+	}
+	if _, err := f.Output(context.Background(), "missing", "ls"); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable for unknown host, got %v", err)
+	}
+
+	err := f.Run(context.Background(), "fail", "make", nil, &stdout, &stderr)
+	if code, _, ok := ExitStatus(err); !ok || code != 3 {
+		t.Errorf("Expected exit status 3, got %d (ok=%v)", code, ok)
+	}
+
+	out, _ := f.Output(context.Background(), "echo", "uname")
+	if string(out) != "uname" {
+		t.Errorf("Expected Respond output 'uname', got %q", out)
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if f.Check(short, "slow") {
+		t.Error("Expected slow host to miss a short timeout")
+	}
+	if !f.Check(context.Background(), "slow") {
+		t.Error("Expected slow host to pass without a deadline")
+	}
+	if f.Check(context.Background(), "down") {
+		t.Error("Expected offline host to fail Check")
+	}
+
+	if got := len(f.Calls()); got != 5 {
+		t.Errorf("Expected 5 recorded calls, got %d", got)
+	}
+}
+
+func TestFake_Rsync(t *testing.T) {
+	f := NewFake(map[string]*FakeHost{
+		"up":   {},
+		"down": {Offline: true},
+	})
+
+	if err := f.Rsync(context.Background(), "push", "-avz", "/src/", "up:~/src/"); err != nil {
+		t.Errorf("Rsync to online host failed: %v", err)
+	}
+	if err := f.Rsync(context.Background(), "push", "-avz", "/src/", "down:~/src/"); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable for offline host, got %v", err)
+	}
+	if got := len(f.Rsyncs()); got != 2 {
+		t.Errorf("Expected 2 recorded rsyncs, got %d", got)
+	}
+}
+
+func TestFake_RunCancelled(t *testing.T) {
+	f := NewFake(map[string]*FakeHost{
+		"slow": {Delay: time.Minute},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := f.Run(ctx, "slow", "make", nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Expected Run to return once the context is done")
+	}
+}
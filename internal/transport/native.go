@@ -0,0 +1,469 @@
+package transport
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WillyV3/distributed/internal/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// dialTimeout bounds connection setup, handshake included, on top of the
+// caller's context
+const dialTimeout = 10 * time.Second
+
+// defaultIdentities are the key files ssh tries when none are configured
+var defaultIdentities = []string{
+	"id_ed25519",
+	"id_ecdsa",
+	"id_rsa",
+}
+
+// Pool keeps one authenticated SSH connection per host so repeated
+// commands against the same host share a single handshake.
+type Pool struct {
+	// Resolve, if set, supplies endpoints that override ~/.ssh/config
+	Resolve Resolver
+
+	mu    sync.Mutex
+	conns map[string]*pooledConn
+
+	hostsOnce sync.Once
+	hosts     []config.SSHHost
+}
+
+type pooledConn struct {
+	// sem is held while dialing or replacing client; a channel rather
+	// than a mutex so waiting for another dial can be given up on
+	sem    chan struct{}
+	client *ssh.Client
+	// jumps are the ProxyJump connections client is tunnelled through,
+	// in the order they were dialled
+	jumps []*ssh.Client
+}
+
+// NewPool creates an empty connection pool
+func NewPool() *Pool {
+	return &Pool{conns: make(map[string]*pooledConn)}
+}
+
+// Run executes a command on a host over a pooled connection
+func (p *Pool) Run(ctx context.Context, host, command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	session, err := p.session(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	// Session.Wait blocks until stdin is drained, so interactive input
+	// is copied separately and abandoned once the command exits.
+	if stdin != nil {
+		w, err := session.StdinPipe()
+		if err != nil {
+			return err
+		}
+		go func() {
+			io.Copy(w, stdin)
+			w.Close()
+		}()
+	}
+
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	return session.Run(command)
+}
+
+// Output executes a command on a host and returns its standard output
+func (p *Pool) Output(ctx context.Context, host, command string) ([]byte, error) {
+	session, err := p.session(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	stop := context.AfterFunc(ctx, func() { session.Close() })
+	defer stop()
+
+	var out bytes.Buffer
+	session.Stdout = &out
+	err = session.Run(command)
+	if ctx.Err() != nil {
+		return out.Bytes(), ctx.Err()
+	}
+	return out.Bytes(), err
+}
+
+// Check reports whether a connection to host can be established before
+// ctx is done
+func (p *Pool) Check(ctx context.Context, host string) bool {
+	_, err := p.client(ctx, host, nil)
+	return err == nil
+}
+
+// Rsync runs rsync with args. rsync manages its own ssh connection.
+func (p *Pool) Rsync(ctx context.Context, title string, args ...string) error {
+	return rsync(ctx, title, rsyncArgs(p.Resolve, args)...)
+}
+
+// Close closes every pooled connection
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for host, c := range p.conns {
+		if c.client != nil {
+			if err := c.client.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		closeJumps(c.jumps)
+		delete(p.conns, host)
+	}
+	return firstErr
+}
+
+// session opens a session on the pooled connection to host. A pooled
+// connection that has dropped is replaced by a new one, once.
+func (p *Pool) session(ctx context.Context, host string) (*ssh.Session, error) {
+	client, err := p.client(ctx, host, nil)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	if client, err = p.client(ctx, host, client); err != nil {
+		return nil, err
+	}
+	session, err = client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to open session: %w", host, err)
+	}
+	return session, nil
+}
+
+// client returns the pooled connection for host, dialing it on first use.
+// If the pooled connection is stale, it is closed and dialed again.
+// Failed dials are not remembered, so a host that was briefly unreachable
+// can be retried.
+func (p *Pool) client(ctx context.Context, host string, stale *ssh.Client) (*ssh.Client, error) {
+	p.mu.Lock()
+	c, ok := p.conns[host]
+	if !ok {
+		c = &pooledConn{sem: make(chan struct{}, 1)}
+		p.conns[host] = c
+	}
+	p.mu.Unlock()
+
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.sem }()
+
+	// Another caller may have replaced the stale connection already
+	if c.client != nil && c.client == stale {
+		c.client.Close()
+		closeJumps(c.jumps)
+		c.client, c.jumps = nil, nil
+	}
+
+	if c.client == nil {
+		client, jumps, err := p.dial(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		c.client, c.jumps = client, jumps
+	}
+	return c.client, nil
+}
+
+// dial connects to alias and returns the client along with the jump
+// host connections it goes through, which must be closed after it
+func (p *Pool) dial(ctx context.Context, alias string) (*ssh.Client, []*ssh.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	h := p.resolve(alias)
+
+	if h.ProxyCommand != "" && h.ProxyCommand != "none" {
+		return nil, nil, fmt.Errorf("%s: ProxyCommand is not supported by the native transport, use --transport exec", alias)
+	}
+
+	// Hop through each jump host in turn, reaching the target from the last
+	var jump *ssh.Client
+	var jumps []*ssh.Client
+	if h.ProxyJump != "" && h.ProxyJump != "none" {
+		for _, hop := range strings.Split(h.ProxyJump, ",") {
+			var err error
+			if jump, err = p.dialVia(ctx, jump, p.resolveJump(hop)); err != nil {
+				closeJumps(jumps)
+				return nil, nil, fmt.Errorf("%s: jump host %s: %w", alias, hop, err)
+			}
+			jumps = append(jumps, jump)
+		}
+	}
+
+	client, err := p.dialVia(ctx, jump, h)
+	if err != nil {
+		closeJumps(jumps)
+		return nil, nil, fmt.Errorf("%s: %w", alias, err)
+	}
+	return client, jumps, nil
+}
+
+// closeJumps closes jump host connections, the last hop first since it
+// is tunnelled through the ones before it
+func closeJumps(jumps []*ssh.Client) {
+	for _, jump := range slices.Backward(jumps) {
+		jump.Close()
+	}
+}
+
+// dialVia connects to h, tunnelling through via when it is not nil. ctx
+// bounds the handshake as well as the connection.
+func (p *Pool) dialVia(ctx context.Context, via *ssh.Client, h config.SSHHost) (*ssh.Client, error) {
+	cfg, closeAgent, err := clientConfig(h)
+	if err != nil {
+		return nil, err
+	}
+	// The agent is only needed while authenticating
+	defer closeAgent()
+
+	addr := net.JoinHostPort(h.Hostname, h.Port)
+	var conn net.Conn
+	if via == nil {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = via.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A host can accept the connection and then stall, so the handshake
+	// gets a deadline and is cut short when ctx is done. Connections
+	// tunnelled through a jump host don't take deadlines; closing them
+	// still works.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if !stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, fmt.Errorf("ssh handshake: %w", ctx.Err())
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// resolveJump resolves a ProxyJump hop of the form [user@]host[:port]
+func (p *Pool) resolveJump(hop string) config.SSHHost {
+	userName, hostPort, hasUser := strings.Cut(hop, "@")
+	if !hasUser {
+		hostPort, userName = userName, ""
+	}
+
+	name, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		name, port = hostPort, ""
+	}
+
+	h := p.resolve(name)
+	if userName != "" {
+		h.User = userName
+	}
+	if port != "" {
+		h.Port = port
+	}
+	return h
+}
+
+// resolve looks up connection settings for an alias in ~/.ssh/config and
+// the Resolve endpoints, falling back to treating the alias as a hostname
+func (p *Pool) resolve(alias string) config.SSHHost {
+	p.hostsOnce.Do(func() {
+		p.hosts, _ = config.ParseSSHConfig()
+	})
+
+	h := config.SSHHost{Alias: alias}
+	if found := config.GetHost(p.hosts, alias); found != nil {
+		h = *found
+	}
+	if p.Resolve != nil {
+		if e, ok := p.Resolve(alias); ok {
+			h.Hostname = cmp.Or(e.Address, h.Hostname)
+			h.User = cmp.Or(e.User, h.User)
+			h.Port = cmp.Or(e.Port, h.Port)
+		}
+	}
+
+	if h.Hostname == "" {
+		h.Hostname = alias
+	}
+	if h.Port == "" {
+		h.Port = "22"
+	}
+	if h.User == "" {
+		h.User = currentUser()
+	}
+	return h
+}
+
+// clientConfig builds SSH client settings using the agent and the host's
+// IdentityFile entries, falling back to the default key names. The
+// returned func closes the agent connection once the handshake is done.
+func clientConfig(h config.SSHHost) (*ssh.ClientConfig, func(), error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostKeys, err := hostKeyCallback(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var auth []ssh.AuthMethod
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" && h.Options["identitiesonly"] != "yes" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	identities := h.IdentityFiles
+	if len(identities) == 0 {
+		for _, name := range defaultIdentities {
+			identities = append(identities, filepath.Join(home, ".ssh", name))
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, path := range identities {
+		if signer := loadKey(path); signer != nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+
+	return &ssh.ClientConfig{
+		User:              h.User,
+		Auth:              auth,
+		HostKeyCallback:   hostKeys,
+		HostKeyAlgorithms: knownAlgorithms(hostKeys, net.JoinHostPort(h.Hostname, h.Port)),
+	}, closeAgent, nil
+}
+
+// hostKeyCallback checks host keys against the known_hosts file at path.
+// A missing file knows no hosts, as it does for ssh.
+func hostKeyCallback(path string) (ssh.HostKeyCallback, error) {
+	hostKeys, err := knownhosts.New(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return fmt.Errorf("unknown host %s: %s does not exist; connect once with ssh to add it", hostname, path)
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := hostKeys(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return fmt.Errorf("unknown host %s: not in %s; connect once with ssh to add it", hostname, path)
+		}
+		return err
+	}, nil
+}
+
+// knownAlgorithms returns the host key algorithms matching the key types
+// known_hosts holds for addr, so the server offers a key that can be
+// checked. It returns nil, leaving the default, for unknown hosts.
+func knownAlgorithms(hostKeys ssh.HostKeyCallback, addr string) []string {
+	// Checking a key no host has lists the keys known for addr
+	err := hostKeys(addr, &net.TCPAddr{}, unknownKey{})
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		algos := []string{known.Key.Type()}
+		if known.Key.Type() == ssh.KeyAlgoRSA {
+			// RSA keys are also used with the SHA-2 signature algorithms
+			algos = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, algo := range algos {
+			if !slices.Contains(algorithms, algo) {
+				algorithms = append(algorithms, algo)
+			}
+		}
+	}
+	return algorithms
+}
+
+// unknownKey is a public key matching no known_hosts entry
+type unknownKey struct{}
+
+func (unknownKey) Type() string                        { return "unknown" }
+func (unknownKey) Marshal() []byte                     { return []byte("unknown") }
+func (unknownKey) Verify([]byte, *ssh.Signature) error { return errors.New("unknown key") }
+
+// loadKey reads an unencrypted private key, returning nil if unusable.
+// Passphrase-protected keys are expected to be served by the agent.
+func loadKey(path string) ssh.Signer {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil
+	}
+	return signer
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,100 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+
+	"github.com/WillyV3/distributed/internal/ui"
+	"golang.org/x/crypto/ssh"
+)
+
+// Transport runs commands on and copies files to remote hosts
+type Transport interface {
+	// Run executes a command on a host with the given standard streams.
+	// Cancelling ctx drops the connection; it does not stop the remote
+	// command by itself.
+	Run(ctx context.Context, host, command string, stdin io.Reader, stdout, stderr io.Writer) error
+	// Output executes a command on a host and returns its standard output
+	Output(ctx context.Context, host, command string) ([]byte, error)
+	// Check reports whether a host accepts connections before ctx is done
+	Check(ctx context.Context, host string) bool
+	// Rsync runs rsync with args, showing title while it transfers
+	Rsync(ctx context.Context, title string, args ...string) error
+	// Close releases any held connections
+	Close() error
+}
+
+// New returns the transport with the given name: "exec" shells out to the
+// ssh binary for every command, "native" uses pooled in-process
+// connections. resolve may be nil.
+func New(name string, resolve Resolver) (Transport, error) {
+	switch name {
+	case "exec":
+		return Exec{Resolve: resolve}, nil
+	case "native":
+		p := NewPool()
+		p.Resolve = resolve
+		return p, nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q (want exec or native)", name)
+	}
+}
+
+// ExitError is returned by transports that do not run a local process
+// when the remote command exits unsuccessfully
+type ExitError struct {
+	Code   int
+	Signal string
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return "remote command killed by signal " + e.Signal
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitStatus extracts the remote exit code and terminating signal from an
+// error returned by Run. ok is false when err does not carry an exit status,
+// for example when the connection could not be established.
+func ExitStatus(err error) (code int, signal string, ok bool) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, isWait := exitErr.Sys().(syscall.WaitStatus); isWait && status.Signaled() {
+			signal = status.Signal().String()
+		}
+		return exitErr.ExitCode(), signal, true
+	}
+
+	var sshErr *ssh.ExitError
+	if errors.As(err, &sshErr) {
+		return sshErr.ExitStatus(), sshErr.Signal(), true
+	}
+
+	var fakeErr *ExitError
+	if errors.As(err, &fakeErr) {
+		return fakeErr.Code, fakeErr.Signal, true
+	}
+
+	return -1, "", false
+}
+
+// Killed reports whether err says the local ssh or rsync process was
+// killed by a signal, such as a Ctrl-C that reached it along with dw
+func Killed(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled()
+}
+
+// rsync runs the local rsync binary, which both transports rely on
+func rsync(ctx context.Context, title string, args ...string) error {
+	return ui.SpinCommand(ctx, title, "rsync", args...)
+}
@@ -0,0 +1,340 @@
+package transport
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestNew(t *testing.T) {
+	tr, err := New("exec", nil)
+	if err != nil {
+		t.Fatalf("New(exec) failed: %v", err)
+	}
+	if _, ok := tr.(Exec); !ok {
+		t.Errorf("Expected Exec transport, got %T", tr)
+	}
+
+	tr, err = New("native", nil)
+	if err != nil {
+		t.Fatalf("New(native) failed: %v", err)
+	}
+	if _, ok := tr.(*Pool); !ok {
+		t.Errorf("Expected *Pool transport, got %T", tr)
+	}
+
+	if _, err := New("telnet", nil); err == nil {
+		t.Error("Expected error for unknown transport")
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   int
+		wantSignal string
+		wantOK     bool
+	}{
+		{
+			name:     "exit code",
+			err:      exec.Command("sh", "-c", "exit 4").Run(),
+			wantCode: 4,
+			wantOK:   true,
+		},
+		{
+			name:       "killed by signal",
+			err:        exec.Command("sh", "-c", "kill -KILL $$").Run(),
+			wantCode:   -1,
+			wantSignal: "killed",
+			wantOK:     true,
+		},
+		{
+			name:     "fake exit",
+			err:      &ExitError{Code: 2},
+			wantCode: 2,
+			wantOK:   true,
+		},
+		{
+			name:     "connection error",
+			err:      errors.New("dial tcp: connection refused"),
+			wantCode: -1,
+			wantOK:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, signal, ok := ExitStatus(tt.err)
+			if code != tt.wantCode || signal != tt.wantSignal || ok != tt.wantOK {
+				t.Errorf("ExitStatus() = (%d, %q, %v), want (%d, %q, %v)",
+					code, signal, ok, tt.wantCode, tt.wantSignal, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPool_Resolve(t *testing.T) {
+	tmpDir := t.TempDir()
+	sshDir := filepath.Join(tmpDir, ".ssh")
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	configContent := `Host homelab
+    HostName 100.72.192.70
+    User wv3
+    Port 2222
+`
+	if err := os.WriteFile(filepath.Join(sshDir, "config"), []byte(configContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", tmpDir)
+	defer os.Setenv("HOME", oldHome)
+
+	p := NewPool()
+
+	h := p.resolve("homelab")
+	if h.Hostname != "100.72.192.70" || h.User != "wv3" || h.Port != "2222" {
+		t.Errorf("Unexpected resolved host: %+v", h)
+	}
+
+	h = p.resolve("unknown.example.com")
+	if h.Hostname != "unknown.example.com" || h.Port != "22" || h.User == "" {
+		t.Errorf("Expected fallback to alias as hostname, got %+v", h)
+	}
+}
+
+func TestPool_ResolveJump(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	p := NewPool()
+
+	tests := []struct {
+		hop      string
+		wantUser string
+		wantHost string
+		wantPort string
+	}{
+		{"bastion", currentUser(), "bastion", "22"},
+		{"ops@bastion", "ops", "bastion", "22"},
+		{"ops@bastion:2200", "ops", "bastion", "2200"},
+		{"bastion:2200", currentUser(), "bastion", "2200"},
+	}
+
+	for _, tt := range tests {
+		h := p.resolveJump(tt.hop)
+		if h.User != tt.wantUser || h.Hostname != tt.wantHost || h.Port != tt.wantPort {
+			t.Errorf("resolveJump(%q) = %s@%s:%s, want %s@%s:%s",
+				tt.hop, h.User, h.Hostname, h.Port, tt.wantUser, tt.wantHost, tt.wantPort)
+		}
+	}
+}
+
+func TestEndpointArgs(t *testing.T) {
+	resolve := func(host string) (Endpoint, bool) {
+		if host == "pi" {
+			return Endpoint{Address: "192.168.1.50", User: "pi", Port: "2222"}, true
+		}
+		return Endpoint{}, false
+	}
+
+	got := sshArgs(resolve, "pi")
+	want := []string{"-o", "HostName=192.168.1.50", "-o", "User=pi", "-o", "Port=2222", "pi"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sshArgs(pi) = %v, want %v", got, want)
+	}
+	if got := sshArgs(resolve, "homelab"); !reflect.DeepEqual(got, []string{"homelab"}) {
+		t.Errorf("sshArgs(homelab) = %v, want just the host", got)
+	}
+	if got := sshArgs(nil, "pi"); !reflect.DeepEqual(got, []string{"pi"}) {
+		t.Errorf("sshArgs without resolver = %v, want just the host", got)
+	}
+
+	args := []string{"-avz", "--exclude", "node_modules", "/src/", "pi:~/projects/src/"}
+	got = rsyncArgs(resolve, args)
+	want = append([]string{"-e", "ssh -o HostName=192.168.1.50 -o User=pi -o Port=2222"}, args...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rsyncArgs() = %v, want %v", got, want)
+	}
+
+	args = []string{"-avz", "homelab:~/projects/src/", "/dest/"}
+	if got := rsyncArgs(resolve, args); !reflect.DeepEqual(got, args) {
+		t.Errorf("rsyncArgs() = %v, want args unchanged", got)
+	}
+}
+
+func TestPool_ResolveEndpoint(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	p := NewPool()
+	p.Resolve = func(host string) (Endpoint, bool) {
+		return Endpoint{Address: "192.168.1.50", Port: "2222"}, host == "pi"
+	}
+
+	h := p.resolve("pi")
+	if h.Hostname != "192.168.1.50" || h.Port != "2222" || h.User != currentUser() {
+		t.Errorf("Expected endpoint to override address and port, got %+v", h)
+	}
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "known_hosts")
+
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	ed, err := ssh.NewPublicKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, err := ssh.NewPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing file knows no hosts but still lets dw run
+	missing, err := hostKeyCallback(path)
+	if err != nil {
+		t.Fatalf("Expected a missing known_hosts to be empty, got %v", err)
+	}
+	if err := missing("homelab:22", &net.TCPAddr{}, ed); err == nil || !strings.Contains(err.Error(), "unknown host") {
+		t.Errorf("Expected an unknown host error, got %v", err)
+	}
+
+	lines := knownhosts.Line([]string{"homelab"}, ed) + "\n" +
+		knownhosts.Line([]string{"[build]:2200"}, rsaPub) + "\n"
+	if err := os.WriteFile(path, []byte(lines), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hostKeys, err := hostKeyCallback(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hostKeys("homelab:22", &net.TCPAddr{}, ed); err != nil {
+		t.Errorf("Expected the known key to pass, got %v", err)
+	}
+	if err := hostKeys("other:22", &net.TCPAddr{}, ed); err == nil || !strings.Contains(err.Error(), "unknown host") {
+		t.Errorf("Expected an unknown host error, got %v", err)
+	}
+
+	tests := map[string][]string{
+		"homelab:22": {ssh.KeyAlgoED25519},
+		"build:2200": {ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA},
+		"build:22":   nil,
+		"unknown:22": nil,
+	}
+	for addr, want := range tests {
+		if got := knownAlgorithms(hostKeys, addr); !reflect.DeepEqual(got, want) {
+			t.Errorf("knownAlgorithms(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+// stallingListener accepts connections and never speaks SSH
+func stallingListener(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return l
+}
+
+func TestPool_RunStalledHandshake(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	l := stallingListener(t)
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	p := NewPool()
+	defer p.Close()
+	p.Resolve = func(host string) (Endpoint, bool) {
+		return Endpoint{Address: "127.0.0.1", Port: port}, true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := p.Run(ctx, "stalled", "true", nil, io.Discard, io.Discard)
+	if err == nil {
+		t.Fatal("Expected the stalled handshake to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Run to give up with ctx, took %s", elapsed)
+	}
+}
+
+func TestPool_RetriesFailedDial(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	// Hang up on every connection, counting them
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- struct{}{}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	p := NewPool()
+	defer p.Close()
+	p.Resolve = func(host string) (Endpoint, bool) {
+		return Endpoint{Address: "127.0.0.1", Port: port}, true
+	}
+
+	for range 2 {
+		if p.Check(context.Background(), "flaky") {
+			t.Fatal("Expected Check to fail")
+		}
+	}
+	for i := range 2 {
+		select {
+		case <-accepted:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a failed dial to be tried again, got %d connections", i)
+		}
+	}
+}
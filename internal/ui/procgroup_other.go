@@ -0,0 +1,8 @@
+//go:build !unix
+
+package ui
+
+import "os/exec"
+
+// OwnProcessGroup does nothing where process groups don't exist
+func OwnProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package ui
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// OwnProcessGroup starts cmd in a process group of its own, so signals
+// from the terminal such as Ctrl-C reach dw but not cmd
+func OwnProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -1,11 +1,22 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 )
 
+// out receives status messages and command progress
+var out io.Writer = os.Stdout
+
+// SetOutput redirects status messages and command progress, e.g. to
+// stderr when stdout carries structured output
+func SetOutput(w io.Writer) {
+	out = w
+}
+
 // hasGum checks if gum is installed
 func hasGum() bool {
 	_, err := exec.LookPath("gum")
@@ -20,12 +31,13 @@ func Spin(title string, fn func() error) error {
 }
 
 // SpinCommand runs a command with a gum spinner
-func SpinCommand(title string, name string, args ...string) error {
+func SpinCommand(ctx context.Context, title string, name string, args ...string) error {
 	if !hasGum() {
-		fmt.Printf("→ %s...\n", title)
-		cmd := exec.Command(name, args...)
-		cmd.Stdout = os.Stdout
+		fmt.Fprintf(out, "→ %s...\n", title)
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdout = out
 		cmd.Stderr = os.Stderr
+		OwnProcessGroup(cmd)
 		return cmd.Run()
 	}
 
@@ -33,9 +45,11 @@ func SpinCommand(title string, name string, args ...string) error {
 	gumArgs := []string{"spin", "--spinner", "dot", "--title", title, "--show-error", "--", name}
 	gumArgs = append(gumArgs, args...)
 
-	cmd := exec.Command("gum", gumArgs...)
+	// gum draws on the terminal, so it stays in the foreground process
+	// group and ctx cancels it as before
+	cmd := exec.CommandContext(ctx, "gum", gumArgs...)
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = out
 	cmd.Stderr = os.Stderr
 
 	return cmd.Run()
@@ -44,16 +58,16 @@ func SpinCommand(title string, name string, args ...string) error {
 // SpinFunc runs a shell command string with a spinner
 func SpinFunc(title string, shellCmd string) error {
 	if !hasGum() {
-		fmt.Printf("→ %s...\n", title)
+		fmt.Fprintf(out, "→ %s...\n", title)
 		cmd := exec.Command("sh", "-c", shellCmd)
-		cmd.Stdout = os.Stdout
+		cmd.Stdout = out
 		cmd.Stderr = os.Stderr
 		return cmd.Run()
 	}
 
 	cmd := exec.Command("gum", "spin", "--spinner", "dot", "--title", title, "--show-error", "--", "sh", "-c", shellCmd)
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = out
 	cmd.Stderr = os.Stderr
 
 	return cmd.Run()
@@ -62,16 +76,16 @@ func SpinFunc(title string, shellCmd string) error {
 // Success prints a success message
 func Success(msg string) {
 	if hasGum() {
-		exec.Command("gum", "style", "--foreground", "212", "✓ "+msg).Run()
+		style("212", "✓ "+msg, out)
 	} else {
-		fmt.Printf("✓ %s\n", msg)
+		fmt.Fprintf(out, "✓ %s\n", msg)
 	}
 }
 
 // Error prints an error message
 func Error(msg string) {
 	if hasGum() {
-		exec.Command("gum", "style", "--foreground", "196", "✗ "+msg).Run()
+		style("196", "✗ "+msg, os.Stderr)
 	} else {
 		fmt.Fprintf(os.Stderr, "✗ %s\n", msg)
 	}
@@ -80,8 +94,28 @@ func Error(msg string) {
 // Info prints an info message
 func Info(msg string) {
 	if hasGum() {
-		exec.Command("gum", "style", "--foreground", "86", "→ "+msg).Run()
+		style("86", "→ "+msg, out)
 	} else {
-		fmt.Printf("→ %s\n", msg)
+		fmt.Fprintf(out, "→ %s\n", msg)
+	}
+}
+
+// style prints text in a gum foreground color
+func style(color, text string, w io.Writer) {
+	cmd := exec.Command("gum", "style", "--foreground", color, text)
+	cmd.Stdout = w
+	cmd.Run()
+}
+
+// ColorEnabled reports whether stdout is a terminal that should get color.
+// Honors the NO_COLOR convention.
+func ColorEnabled() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
 }